@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+)
+
+const (
+	APPCTL_COMMAND = "appctl"
+	APPCTL_TARGET  = "ovs-vswitchd"
+)
+
+// dialTarget connects to target like ovs-appctl does, either a path to a
+// control socket or the name of a daemon running in runDir, which defaults
+// to the one of its profile.  A daemon whose process is not visible, from a
+// sidecar without a shared pid namespace, is reached through its socket.
+func dialTarget(runDir, target string) (*appctl.Client, error) {
+	if strings.Contains(target, "/") {
+		return appctl.Dial("unix", target)
+	}
+
+	prof, err := targetProfile(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if runDir == "" {
+		runDir = prof.runDir()
+	}
+
+	client, err := prof.dial(runDir)
+	if errors.Is(err, appctl.ErrPidNamespace) {
+		slog.Debug("daemon is in another pid namespace, dialing its control socket", "error", err)
+		return appctl.DialSocket(runDir, prof.name)
+	}
+
+	return client, err
+}
+
+// targetProfile returns the profile of target, which ovs-appctl names after
+// the pid file of the daemon, such as ovnnb_db for the OVN databases which
+// run as ovsdb-server.
+func targetProfile(target string) (*profile, error) {
+	for name, p := range profiles {
+		if p.name == target {
+			return lookupProfile(name, p.binary)
+		}
+	}
+
+	return lookupProfile("", target)
+}
+
+func writeReply(w io.Writer, format, command, reply string) error {
+	switch format {
+	case "text":
+		_, err := io.WriteString(w, reply)
+		return err
+	case "json":
+		result, ok, err := appctl.ParseReply(command, reply)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			result = reply
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// appctlCommand sends a command to a daemon without needing ovs-appctl,
+// exiting with 2 when the daemon returns an error like ovs-appctl does.
+func appctlCommand(args []string) int {
+	fs := flag.NewFlagSet(APPCTL_COMMAND, flag.ContinueOnError)
+	target := fs.String("target", APPCTL_TARGET, "Binary or control socket path to send the command to")
+	fs.StringVar(target, "t", APPCTL_TARGET, "Shorthand for -target")
+	timeout := fs.Int("timeout", 0, "Seconds to wait for a reply, 0 to wait forever")
+	fs.IntVar(timeout, "T", 0, "Shorthand for -timeout")
+	format := fs.String("format", "text", "Output format (text or json)")
+	runDir := fs.String("run-dir", "", "Run directory of the target, defaults to OVS_RUNDIR or OVN_RUNDIR and then to the one of the target")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() == 0 {
+		slog.Error("usage: ovsinit appctl [-t <target>] [-T <secs>] [--format text|json] <command> [args...]")
+		return 1
+	}
+	command, commandArgs := fs.Arg(0), fs.Args()[1:]
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(*timeout)*time.Second)
+		defer cancel()
+	}
+
+	client, err := dialTarget(*runDir, *target)
+	if err != nil {
+		slog.Error("failed to connect to target", "target", *target, "error", err)
+		return 1
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Warn("failed to close client", "error", err)
+		}
+	}()
+
+	reply, err := client.Run(ctx, command, commandArgs...)
+
+	var commandErr *appctl.CommandError
+	if errors.As(err, &commandErr) {
+		_, _ = fmt.Fprintln(os.Stderr, commandErr.Message)
+		slog.Error("server returned an error", "target", *target)
+		return 2
+	}
+	if err != nil {
+		slog.Error("failed to run command", "target", *target, "command", command, "error", err)
+		return 1
+	}
+
+	if err := writeReply(os.Stdout, *format, command, reply); err != nil {
+		slog.Error("failed to write reply", "error", err)
+		return 1
+	}
+
+	return 0
+}
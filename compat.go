@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vexxhost/ovsinit/pkg/compat"
+)
+
+// compatPolicy returns the version compatibility policy set by the flags
+func compatPolicy() (compat.Policy, error) {
+	policy := compat.Policy{
+		BlockDowngrades: *blockDowngrades,
+		MajorUpgrades:   *majorUpgrades,
+	}
+
+	switch policy.MajorUpgrades {
+	case compat.MAJOR_ALLOW, compat.MAJOR_BLOCK, compat.MAJOR_REQUIRE_CONVERSION:
+	default:
+		return policy, fmt.Errorf("invalid -major-upgrades %q, must be %s, %s or %s", policy.MajorUpgrades, compat.MAJOR_ALLOW, compat.MAJOR_BLOCK, compat.MAJOR_REQUIRE_CONVERSION)
+	}
+
+	for _, value := range splitList(*allowedUpgrades) {
+		upgrade, err := compat.ParseUpgrade(value)
+		if err != nil {
+			return policy, err
+		}
+		policy.AllowedUpgrades = append(policy.AllowedUpgrades, upgrade)
+	}
+
+	return policy, nil
+}
+
+// checkCompatibility checks the versions of the existing and new processes
+// against the policy, failing with compat.ErrIncompatible if the handoff is
+// unsafe or, with a policy set, if either version is unknown.  Daemons
+// without a database have nothing to convert, and the database is only
+// looked at when the policy depends on it being converted.
+func (h *handoff) checkCompatibility(ctx context.Context, db *databaseOptions) error {
+	converting := true
+	if h.profile.database && h.compat.MajorUpgrades == compat.MAJOR_REQUIRE_CONVERSION {
+		var err error
+		converting, err = db.converts(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check if the database is converted: %w", err)
+		}
+	}
+
+	return h.compat.Check(h.replacedVersion, h.incomingVersion, converting)
+}
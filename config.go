@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vexxhost/ovsinit/pkg/config"
+)
+
+// configFlags returns the values of the flags set by cfg
+func configFlags(cfg *config.Config) map[string]string {
+	values := map[string]string{}
+
+	setString := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	setList := func(name string, value []string) {
+		if len(value) > 0 {
+			values[name] = strings.Join(value, ",")
+		}
+	}
+	setDuration := func(name string, value *config.Duration) {
+		if value != nil {
+			values[name] = value.String()
+		}
+	}
+	setInt := func(name string, value *int) {
+		if value != nil {
+			values[name] = strconv.Itoa(*value)
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			values[name] = strconv.FormatBool(*value)
+		}
+	}
+
+	setString("profile", cfg.Profile)
+	setString("run-dir", cfg.RunDir)
+
+	setDuration("dial-timeout", cfg.Timeouts.Dial)
+	setDuration("verify-timeout", cfg.Timeouts.Verify)
+	setDuration("leave-cluster-timeout", cfg.Timeouts.LeaveCluster)
+
+	setString("ovs-db", cfg.Database.Path)
+	setString("ovs-schema", cfg.Database.Schema)
+	setInt("ovs-db-backups", cfg.Database.Backups)
+	setBool("ovs-db-restore-backup", cfg.Database.RestoreBackup)
+	setString("ovs-db-cluster-local", cfg.Database.Cluster.Local)
+	setList("ovs-db-cluster-remotes", cfg.Database.Cluster.Remotes)
+	setList("ovs-db-endpoints", cfg.Database.Cluster.Endpoints)
+	setBool("ovs-db-cluster-leave", cfg.Database.Cluster.Leave)
+	setString("ovs-db-private-key", cfg.Database.Cluster.TLS.PrivateKey)
+	setString("ovs-db-certificate", cfg.Database.Cluster.TLS.Certificate)
+	setString("ovs-db-ca-cert", cfg.Database.Cluster.TLS.CACert)
+
+	setString("succession-backend", cfg.Succession.Backend)
+	setDuration("succession-ttl", cfg.Succession.TTL)
+	setInt("succession-max-history", cfg.Succession.MaxHistory)
+
+	setString("metrics-file", cfg.Metrics.Textfile)
+	setString("report-file", cfg.ReportFile)
+
+	setBool("supervise", cfg.Supervise)
+
+	setBool("block-downgrades", cfg.Compatibility.BlockDowngrades)
+	setString("major-upgrades", cfg.Compatibility.MajorUpgrades)
+	setList("allowed-upgrades", cfg.Compatibility.AllowedUpgrades)
+
+	setString("log-level", cfg.Log.Level)
+	setString("log-format", cfg.Log.Format)
+
+	return values
+}
+
+// applyConfig sets the flags of fs from cfg, except those given on the
+// command line which take precedence.  Settings without a flag in fs, such
+// as those only the prestop subcommand uses, are skipped.
+func applyConfig(fs *flag.FlagSet, cfg *config.Config) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for name, value := range configFlags(cfg) {
+		if explicit[name] || fs.Lookup(name) == nil {
+			continue
+		}
+
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("failed to set %s from config: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyConfig overrides the verifiers of the profile with those of cfg
+func (p *profile) applyConfig(cfg *config.Config) {
+	if cfg.Verifiers.HugePages != nil {
+		p.hugePages = *cfg.Verifiers.HugePages
+	}
+
+	p.fileRemoval = append(p.fileRemoval, cfg.Verifiers.FileRemoval...)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+	"github.com/vexxhost/ovsinit/pkg/ovsdb"
+	"github.com/vexxhost/ovsinit/pkg/ovsdbtool"
+)
+
+// databaseOptions configures how the OVS database is created and converted
+type databaseOptions struct {
+	path          string
+	schema        string
+	backups       int
+	restoreBackup bool
+
+	// clusterLocal is the raft address of this member, setting it creates a
+	// clustered database, joining clusterRemotes if any are given.
+	clusterLocal   string
+	clusterRemotes []string
+
+	// endpoints are the client endpoints of the cluster members, used to
+	// convert clustered databases through the leader.
+	endpoints []string
+
+	// tlsConfig is used to connect to ssl: endpoints
+	tlsConfig *tls.Config
+}
+
+// validate rejects options which could only fail once the existing daemon
+// exited, such as converting a clustered database without endpoints
+func (opts databaseOptions) validate() error {
+	if opts.path == "" || opts.schema == "" || len(opts.endpoints) > 0 {
+		return nil
+	}
+
+	clustered, err := ovsdbtool.IsClustered(opts.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if clustered {
+		return fmt.Errorf("converting clustered database %s requires -ovs-db-endpoints", opts.path)
+	}
+
+	return nil
+}
+
+// converts returns whether the database is brought to the schema before the
+// new daemon starts.  Clustered databases are converted through their leader,
+// so without one reachable they are left at the schema they have.
+func (opts *databaseOptions) converts(ctx context.Context) (bool, error) {
+	if opts.path == "" || opts.schema == "" {
+		return false, nil
+	}
+
+	clustered, err := ovsdbtool.IsClustered(opts.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !clustered {
+		return true, nil
+	}
+
+	header, err := ovsdbtool.ReadClusterHeader(opts.path)
+	if err != nil {
+		return false, err
+	}
+
+	client, err := ovsdb.DialLeader(ctx, opts.endpoints, header.Name, opts.tlsConfig)
+	if err != nil {
+		slog.Warn("failed to find cluster leader, clustered database will not be converted", "db", header.Name, "error", err)
+		return false, nil
+	}
+
+	if err := client.Close(); err != nil {
+		slog.Warn("failed to close database client", "error", err)
+	}
+
+	return true, nil
+}
+
+// databaseTLS returns the TLS configuration to connect to endpoints, nil
+// when no file is given.  Since ssl: endpoints cannot be connected to
+// without one, they are rejected up front rather than when converting.
+func databaseTLS(privateKey, certificate, caCert string, endpoints []string) (*tls.Config, error) {
+	if privateKey == "" && certificate == "" && caCert == "" {
+		for _, endpoint := range endpoints {
+			if strings.HasPrefix(endpoint, "ssl:") {
+				return nil, fmt.Errorf("endpoint %s requires -ovs-db-private-key, -ovs-db-certificate and -ovs-db-ca-cert", endpoint)
+			}
+		}
+
+		return nil, nil
+	}
+
+	if privateKey == "" || certificate == "" || caCert == "" {
+		return nil, errors.New("-ovs-db-private-key, -ovs-db-certificate and -ovs-db-ca-cert are all required")
+	}
+
+	return ovsdb.LoadTLSConfig(privateKey, certificate, caCert)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func initializeOVSDatabase(ctx context.Context, opts databaseOptions) error {
+	dbDir := filepath.Dir(opts.path)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		return fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	if _, err := os.Stat(opts.path); os.IsNotExist(err) {
+		if err := createOVSDatabase(ctx, opts); err != nil {
+			return fmt.Errorf("failed to create database: %w", err)
+		}
+
+		slog.Info("created OVS database", "path", opts.path, "clustered", opts.clusterLocal != "")
+	}
+
+	if opts.schema == "" {
+		return nil
+	}
+
+	clustered, err := ovsdbtool.IsClustered(opts.path)
+	if err != nil {
+		return fmt.Errorf("failed to check if database is clustered: %w", err)
+	}
+
+	if clustered {
+		return convertClusteredOVSDatabase(ctx, opts)
+	}
+
+	needsConversion, err := ovsdbtool.NeedsConversion(opts.path, opts.schema)
+	if err != nil {
+		return fmt.Errorf("failed to check if database needs conversion: %w", err)
+	}
+
+	if needsConversion {
+		return convertOVSDatabase(opts)
+	}
+
+	return nil
+}
+
+func createOVSDatabase(ctx context.Context, opts databaseOptions) error {
+	switch {
+	case opts.clusterLocal == "":
+		return ovsdbtool.Create(opts.path, opts.schema)
+	case len(opts.clusterRemotes) == 0:
+		return ovsdbtool.CreateCluster(ctx, opts.path, opts.schema, opts.clusterLocal)
+	}
+
+	schemaPath := opts.schema
+	if schemaPath == "" {
+		schemaPath = ovsdbtool.DEFAULT_SCHEMA
+	}
+
+	schema, err := ovsdbtool.ReadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	return ovsdbtool.JoinCluster(ctx, opts.path, schema.Name, opts.clusterLocal, opts.clusterRemotes)
+}
+
+func convertOVSDatabase(opts databaseOptions) error {
+	dbVersion, err := ovsdbtool.DbVersion(opts.path)
+	if err != nil {
+		return fmt.Errorf("failed to get database version: %w", err)
+	}
+
+	schema, err := ovsdbtool.ReadSchema(opts.schema)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	if opts.backups > 0 {
+		backup, err := ovsdbtool.Backup(opts.path)
+		if err != nil {
+			return fmt.Errorf("failed to back up database: %w", err)
+		}
+
+		slog.Info("backed up OVS database", "path", opts.path, "backup", backup)
+	}
+
+	if opts.restoreBackup && ovsdbtool.CompareVersions(schema.Version, dbVersion) < 0 {
+		restored, err := ovsdbtool.RestoreBackup(opts.path, schema.Version)
+		if err != nil {
+			return fmt.Errorf("failed to restore database backup: %w", err)
+		}
+
+		if restored {
+			slog.Info("restored OVS database backup", "path", opts.path, "from_version", dbVersion, "to_version", schema.Version)
+
+			needsConversion, err := ovsdbtool.NeedsConversion(opts.path, opts.schema)
+			if err != nil {
+				return fmt.Errorf("failed to check if restored database needs conversion: %w", err)
+			}
+
+			if !needsConversion {
+				pruneBackups(opts)
+				return nil
+			}
+		}
+	}
+
+	if err := ovsdbtool.Convert(opts.path, opts.schema); err != nil {
+		return fmt.Errorf("failed to convert database: %w", err)
+	}
+
+	// Keep every backup unless the converted database can be read back at
+	// the new schema, since one of them may be needed to recover
+	needsConversion, err := ovsdbtool.NeedsConversion(opts.path, opts.schema)
+	if err != nil {
+		return fmt.Errorf("failed to verify converted database: %w", err)
+	}
+	if needsConversion {
+		return fmt.Errorf("converted database %s does not match schema %s", opts.path, opts.schema)
+	}
+
+	slog.Info("converted OVS database", "path", opts.path, "schema", opts.schema, "from_version", dbVersion, "to_version", schema.Version)
+	pruneBackups(opts)
+	return nil
+}
+
+// pruneBackups removes the oldest backups of the database, once it was
+// converted or restored successfully
+func pruneBackups(opts databaseOptions) {
+	if opts.backups <= 0 {
+		return
+	}
+
+	if err := ovsdbtool.PruneBackups(opts.path, opts.backups); err != nil {
+		slog.Warn("failed to prune database backups", "error", err)
+	}
+}
+
+// convertClusteredOVSDatabase converts a clustered database online through
+// the cluster leader, since its members share the data through raft.
+func convertClusteredOVSDatabase(ctx context.Context, opts databaseOptions) error {
+	if len(opts.endpoints) == 0 {
+		return fmt.Errorf("converting clustered database %s requires -ovs-db-endpoints", opts.path)
+	}
+
+	header, err := ovsdbtool.ReadClusterHeader(opts.path)
+	if err != nil {
+		return err
+	}
+
+	schema, err := ovsdbtool.ReadSchema(opts.schema)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	client, err := ovsdb.DialLeader(ctx, opts.endpoints, header.Name, opts.tlsConfig)
+	if errors.Is(err, ovsdb.ErrInvalidEndpoint) {
+		return err
+	}
+	if err != nil {
+		// A new cluster or one which lost quorum has no leader yet, the
+		// next member to be restarted with this schema will convert it.
+		slog.Warn("failed to find cluster leader, skipping clustered database conversion", "db", header.Name, "error", err)
+		return nil
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Warn("failed to close database client", "error", err)
+		}
+	}()
+
+	current, err := client.GetSchema(ctx, header.Name)
+	if err != nil {
+		return err
+	}
+
+	if ovsdbtool.SchemaEqual(current, schema) {
+		return nil
+	}
+
+	// A member with a newer schema may already have converted the cluster
+	// while the others are rolled, which must not be converted back
+	if ovsdbtool.CompareVersions(schema.Version, current.Version) <= 0 {
+		slog.Info("keeping clustered OVS database at its schema", "db", header.Name, "version", current.Version, "schema_version", schema.Version)
+		return nil
+	}
+
+	if err := client.Convert(ctx, header.Name, schema); err != nil {
+		return err
+	}
+
+	slog.Info("converted clustered OVS database", "db", header.Name, "from_version", current.Version, "to_version", schema.Version)
+	return nil
+}
+
+// leaveCluster makes the running server leave the cluster of the database at
+// dbPath, waiting until it has left.
+func leaveCluster(ctx context.Context, client *appctl.Client, dbPath string) error {
+	header, err := ovsdbtool.ReadClusterHeader(dbPath)
+	if err != nil {
+		return err
+	}
+
+	if err := client.ClusterLeave(ctx, header.Name); err != nil {
+		return fmt.Errorf("failed to leave cluster: %w", err)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		status, err := client.ClusterStatus(ctx, header.Name)
+		if err != nil || status.Status != "leaving cluster" {
+			slog.Info("left cluster", "db", header.Name)
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting to leave cluster: %w", ctx.Err())
+		}
+	}
+}
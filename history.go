@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/succession"
+)
+
+const (
+	HISTORY_COMMAND = "history"
+)
+
+var historyColumns = []string{"ID", "OWNER", "CLAIMED_AT", "NODE", "IMAGE", "REPLACED_VERSION", "HANDOFF_MS", "OUTCOME", "EXIT_STATUS"}
+
+func historyRecord(entry succession.HistoryEntry) []string {
+	claimedAt := ""
+	if entry.ClaimedAt != nil {
+		claimedAt = entry.ClaimedAt.Format(time.RFC3339)
+	}
+
+	return []string{
+		strconv.FormatUint(uint64(entry.ID), 10),
+		entry.Owner,
+		claimedAt,
+		entry.Node,
+		entry.Image,
+		entry.ReplacedVersion,
+		strconv.FormatInt(entry.HandoffDurationMs, 10),
+		entry.Outcome,
+		entry.ExitStatus,
+	}
+}
+
+func writeHistory(w io.Writer, format string, history []succession.HistoryEntry) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, strings.Join(historyColumns, "\t"))
+		for _, record := range historyRecords(history) {
+			for i, field := range record {
+				if field == "" {
+					record[i] = "-"
+				}
+			}
+			_, _ = fmt.Fprintln(tw, strings.Join(record, "\t"))
+		}
+		return tw.Flush()
+	case "json":
+		if history == nil {
+			history = []succession.HistoryEntry{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(history)
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(append([][]string{historyColumns}, historyRecords(history)...)); err != nil {
+			return err
+		}
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func historyRecords(history []succession.HistoryEntry) [][]string {
+	records := make([][]string, 0, len(history))
+	for _, entry := range history {
+		records = append(records, historyRecord(entry))
+	}
+
+	return records
+}
+
+// history prints the succession history of a binary without modifying it
+func history(args []string) int {
+	fs := flag.NewFlagSet(HISTORY_COMMAND, flag.ContinueOnError)
+	binary := fs.String("binary", "", "Binary to show the succession history for")
+	profileName := fs.String("profile", "", "Handoff profile of the binary, defaults to the one named after the binary")
+	backend := fs.String("succession-backend", SUCCESSION_BACKEND_SQLITE, "Succession backend to read the history from (sqlite or lease)")
+	dbPath := fs.String("db", "", "Path to the succession database, defaults to the one of the binary, implies the sqlite backend")
+	runDir := fs.String("run-dir", "", "Run directory of the binary, defaults to OVS_RUNDIR or OVN_RUNDIR and then to the one of the binary")
+	format := fs.String("output", "table", "Output format (table, json or csv)")
+	owner := fs.String("owner", "", "Only show entries claimed by this owner")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *binary == "" && *dbPath == "" {
+		slog.Error("usage: ovsinit history --binary <binary> [--succession-backend sqlite|lease] [--output table|json|csv] [--owner <pod>]")
+		return 2
+	}
+
+	var marker *succession.Marker
+	if *dbPath != "" {
+		sqlite, err := succession.OpenSQLiteBackend(*dbPath, nil)
+		if err != nil {
+			slog.Error("failed to open succession database", "path", *dbPath, "error", err)
+			return 1
+		}
+
+		marker = succession.NewWithBackend(sqlite, "")
+	} else {
+		prof, err := lookupProfile(*profileName, *binary)
+		if err != nil {
+			slog.Error("failed to find profile", "error", err)
+			return 2
+		}
+
+		if *runDir == "" {
+			*runDir = prof.runDir()
+		}
+
+		marker, err = openSuccessionMarker(*backend, *runDir, prof.name, "", nil)
+		if err != nil {
+			slog.Error("failed to open succession marker", "backend", *backend, "error", err)
+			return 1
+		}
+	}
+	defer func() {
+		if err := marker.Close(); err != nil {
+			slog.Warn("failed to close succession marker", "error", err)
+		}
+	}()
+
+	entries, err := marker.GetHistory(context.TODO())
+	if err != nil {
+		slog.Error("failed to read succession history", "error", err)
+		return 1
+	}
+
+	if *owner != "" {
+		filtered := entries[:0]
+		for _, entry := range entries {
+			if entry.Owner == *owner {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+
+	if err := writeHistory(os.Stdout, *format, entries); err != nil {
+		slog.Error("failed to write succession history", "error", err)
+		return 1
+	}
+
+	return 0
+}
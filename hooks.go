@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/vexxhost/ovsinit/pkg/config"
+	"github.com/vexxhost/ovsinit/pkg/hooks"
+)
+
+// configHooks returns the hooks of cfg which run for daemon
+func configHooks(cfg *config.Config, daemon string) (hooks.Hooks, error) {
+	var set hooks.Hooks
+	for i, c := range cfg.Hooks {
+		if len(c.Daemons) > 0 && !slices.Contains(c.Daemons, daemon) {
+			continue
+		}
+
+		entry := hooks.Entry{
+			Name:     c.Name,
+			FailOpen: c.Policy == hooks.POLICY_FAIL_OPEN,
+		}
+		if c.Timeout != nil {
+			entry.Timeout = c.Timeout.Duration
+		}
+
+		if len(c.Command) > 0 {
+			entry.Hook = hooks.Command(c.Command...)
+		} else {
+			hook, err := hooks.Func(c.Func, c.Args...)
+			if err != nil {
+				return set, fmt.Errorf("hooks[%d]: %w", i, err)
+			}
+			entry.Hook = hook
+		}
+
+		set.Add(c.Phase, entry)
+	}
+
+	return set, nil
+}
+
+// runHooks runs the hooks of phase, recording a phase of the handoff for
+// each of them.  Only hooks run before the exit get a client to the daemon.
+func (h *handoff) runHooks(ctx context.Context, phaseName string) error {
+	env := hooks.Env{
+		Phase:  phaseName,
+		Daemon: h.profile.name,
+		Binary: h.binary,
+		Pod:    h.pod,
+		RunDir: h.runDir,
+	}
+
+	if h.client != nil {
+		env.Pid = h.client.Process.Pid
+		if phaseName == hooks.PHASE_PRE_CLAIM || phaseName == hooks.PHASE_PRE_EXIT {
+			env.Client = h.client
+		}
+	}
+
+	results, err := h.hooks.Run(ctx, env)
+	for _, result := range results {
+		h.phases = append(h.phases, phase{
+			name:  fmt.Sprintf("hook:%s:%s", phaseName, result.Name),
+			start: result.Start,
+			end:   result.End,
+			err:   result.Err,
+		})
+	}
+
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+
+	LOG_LEVEL_ENV  = "OVSINIT_LOG_LEVEL"
+	LOG_FORMAT_ENV = "OVSINIT_LOG_FORMAT"
+)
+
+// envDefault returns the value of the environment variable name, or
+// fallback when it is unset or empty
+func envDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// logFlags adds the -log-level and -log-format flags to fs, defaulting to
+// their environment variables.
+func logFlags(fs *flag.FlagSet) (level, format *string) {
+	level = fs.String("log-level", envDefault(LOG_LEVEL_ENV, slog.LevelInfo.String()), "Minimum level of the logs (debug, info, warn or error), defaults to "+LOG_LEVEL_ENV)
+	format = fs.String("log-format", envDefault(LOG_FORMAT_ENV, LOG_FORMAT_TEXT), "Format of the logs (text or json), defaults to "+LOG_FORMAT_ENV)
+	return level, format
+}
+
+// newLogHandler creates the handler writing logs of at least level to w in
+// format
+func newLogHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case LOG_FORMAT_TEXT:
+		return slog.NewTextHandler(w, opts), nil
+	case LOG_FORMAT_JSON:
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %s or %s", format, LOG_FORMAT_TEXT, LOG_FORMAT_JSON)
+	}
+}
@@ -4,16 +4,17 @@ import (
 	"context"
 	"errors"
 	"flag"
-	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/vexxhost/ovsinit/pkg/appctl"
+	"github.com/vexxhost/ovsinit/pkg/compat"
+	"github.com/vexxhost/ovsinit/pkg/config"
+	"github.com/vexxhost/ovsinit/pkg/hooks"
+	"github.com/vexxhost/ovsinit/pkg/ovsdbtool"
 	"github.com/vexxhost/ovsinit/pkg/succession"
 	"github.com/vexxhost/ovsinit/pkg/verifier"
 )
@@ -21,50 +22,99 @@ import (
 var (
 	ovsDB     = flag.String("ovs-db", "", "Path to OVS database file")
 	ovsSchema = flag.String("ovs-schema", "", "Path to OVS schema file")
-)
 
-func initializeOVSDatabase(dbPath, schemaPath string) error {
-	dbDir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		return fmt.Errorf("failed to create database directory: %w", err)
-	}
+	ovsDBBackups       = flag.Int("ovs-db-backups", ovsdbtool.MAX_BACKUPS, "Number of OVS database backups to keep before conversion, 0 to disable")
+	ovsDBRestoreBackup = flag.Bool("ovs-db-restore-backup", false, "Restore the OVS database backup matching an older schema instead of converting")
 
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		cmd := exec.Command("ovsdb-tool", "create", dbPath)
-		if schemaPath != "" {
-			cmd = exec.Command("ovsdb-tool", "create", dbPath, schemaPath)
-		}
+	ovsDBClusterLocal   = flag.String("ovs-db-cluster-local", "", "Local raft address of this member, creates a clustered OVS database")
+	ovsDBClusterRemotes = flag.String("ovs-db-cluster-remotes", "", "Comma-separated raft addresses of the members to join, empty to create a new cluster")
+	ovsDBEndpoints      = flag.String("ovs-db-endpoints", "", "Comma-separated client endpoints of the cluster members used for online conversion")
 
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to create database: %w, output: %s", err, output)
-		}
+	ovsDBPrivateKey  = flag.String("ovs-db-private-key", "", "Private key to connect to ssl: endpoints")
+	ovsDBCertificate = flag.String("ovs-db-certificate", "", "Certificate to connect to ssl: endpoints")
+	ovsDBCACert      = flag.String("ovs-db-ca-cert", "", "CA certificate the ssl: endpoints are checked against")
 
-		slog.Info("created OVS database", "path", dbPath)
-	}
+	profileName = flag.String("profile", "", "Handoff profile of the daemon, defaults to the one named after the binary")
+	runDirFlag  = flag.String("run-dir", "", "Directory of the pid file and control socket of the binary, defaults to OVS_RUNDIR or OVN_RUNDIR and then to the one of the binary")
 
-	if schemaPath != "" {
-		cmd := exec.Command("ovsdb-tool", "needs-conversion", dbPath, schemaPath)
-		output, err := cmd.Output()
-		if err != nil {
-			return fmt.Errorf("failed to check if database needs conversion: %w", err)
-		}
+	successionBackend    = flag.String("succession-backend", SUCCESSION_BACKEND_SQLITE, "Succession backend to use (sqlite or lease)")
+	successionTTL        = flag.Duration("succession-ttl", succession.DEFAULT_TTL, "How long a claim stays valid while handing off without being renewed, 0 to never expire")
+	successionMaxHistory = flag.Int("succession-max-history", succession.MAX_HISTORY, "Number of succession history entries to keep")
 
-		if strings.TrimSpace(string(output)) == "yes" {
-			cmd := exec.Command("ovsdb-tool", "convert", dbPath, schemaPath)
-			if output, err := cmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to convert database: %w, output: %s", err, output)
-			}
+	dialTimeout   = flag.Duration("dial-timeout", DIAL_TIMEOUT, "How long to retry connecting to an existing process which is unreachable")
+	verifyTimeout = flag.Duration("verify-timeout", VERIFY_TIMEOUT, "How long to wait for the existing process to exit and clean up")
+
+	blockDowngrades = flag.Bool("block-downgrades", false, "Refuse to replace the existing process with an older version")
+	majorUpgrades   = flag.String("major-upgrades", compat.MAJOR_ALLOW, "Whether to replace the existing process with a new major version (allow, block or require-conversion, which requires -ovs-schema for daemons serving a database)")
+	allowedUpgrades = flag.String("allowed-upgrades", "", "Comma-separated from:to version prefixes of the only upgrades allowed, such as 3.3:3.4")
+
+	metricsFile = flag.String("metrics-file", "", "Path to write Prometheus metrics of the handoff to, for the node_exporter textfile collector")
+	reportFile  = flag.String("report-file", "", "Path to write the JSON report of the handoff to, such as /dev/termination-log")
+
+	dryRunFlag    = flag.Bool("dry-run", false, "Run the read-only steps of the handoff and print its plan, without claiming the succession, stopping the existing process, converting the database or starting the binary")
+	superviseFlag = flag.Bool("supervise", false, "Start the binary as a child and stay PID 1 to forward signals, reap orphans and record its exit, instead of exec'ing it")
+
+	logLevel, logFormat = logFlags(flag.CommandLine)
+
+	configPath = flag.String("config", "", "Path to a YAML configuration file, flags override its values")
+)
+
+const (
+	DIAL_TIMEOUT          = 10 * time.Second
+	DIAL_RETRY_INTERVAL   = 500 * time.Millisecond
+	VERIFY_TIMEOUT        = 30 * time.Second
+	LEAVE_CLUSTER_TIMEOUT = 30 * time.Second
+	VERSION_TIMEOUT       = 10 * time.Second
+)
+
+// subcommands are run instead of the handoff when named as the first argument
+var subcommands = map[string]func(args []string) int{
+	RESTORE_FLOWS_COMMAND: restoreFlows,
+	HISTORY_COMMAND:       history,
+	APPCTL_COMMAND:        appctlCommand,
+	PROBE_COMMAND:         probe,
+	PRESTOP_COMMAND:       prestop,
+}
 
-			slog.Info("converted OVS database", "path", dbPath, "schema", schemaPath)
+// dialDaemon connects to the running daemon, retrying while it is running
+// but its control socket is briefly unavailable.
+func dialDaemon(p *profile, runDir string) (*appctl.Client, error) {
+	deadline := time.Now().Add(*dialTimeout)
+	for {
+		client, err := p.dial(runDir)
+		if !errors.Is(err, appctl.ErrUnreachable) || time.Now().After(deadline) {
+			return client, err
 		}
-	}
 
-	return nil
+		slog.Debug("existing process is unreachable, retrying", "error", err)
+		time.Sleep(DIAL_RETRY_INTERVAL)
+	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(subcommand(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = config.Load(*configPath)
+		if err != nil {
+			slog.Error("failed to load config", "path", *configPath, "error", err)
+			os.Exit(1)
+		}
+
+		if err := applyConfig(flag.CommandLine, cfg); err != nil {
+			slog.Error("failed to apply config", "path", *configPath, "error", err)
+			os.Exit(1)
+		}
+	}
+
 	cmdArgs := flag.Args()
 	if len(cmdArgs) == 0 {
 		slog.Error("usage: ovsinit [flags] -- <binary> <args...>")
@@ -75,19 +125,86 @@ func main() {
 	binary := filepath.Base(binaryPath)
 	processArgs := cmdArgs[1:]
 
-	logger := slog.New(slog.NewTextHandler(os.Stderr, nil)).With("binary", binary)
+	handler, err := newLogHandler(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		slog.Error("failed to configure logging", "error", err)
+		os.Exit(1)
+	}
+
+	logger := slog.New(handler).With("binary", binary)
 	slog.SetDefault(logger)
 
+	prof, err := lookupProfile(*profileName, binary)
+	if err != nil {
+		slog.Error("failed to find profile", "error", err)
+		os.Exit(1)
+	}
+
+	if *successionMaxHistory < 1 {
+		slog.Error("-succession-max-history must be at least 1", "value", *successionMaxHistory)
+		os.Exit(1)
+	}
+
+	compatibility, err := compatPolicy()
+	if err != nil {
+		slog.Error("invalid compatibility policy", "error", err)
+		os.Exit(1)
+	}
+
+	var handoffHooks hooks.Hooks
+	if cfg != nil {
+		prof.applyConfig(cfg)
+
+		handoffHooks, err = configHooks(cfg, prof.name)
+		if err != nil {
+			slog.Error("failed to configure hooks", "path", *configPath, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *ovsDB != "" && !prof.database {
+		slog.Error("-ovs-db is not supported by the profile of the binary", "profile", prof.name)
+		os.Exit(1)
+	}
+
+	runDir := *runDirFlag
+	if runDir == "" {
+		runDir = prof.runDir()
+	}
+
 	podName := os.Getenv("POD_NAME")
 	if podName == "" {
 		slog.Error("POD_NAME environment variable must be set for succession tracking")
 		os.Exit(1)
 	}
 
-	marker, err := succession.New(
-		filepath.Join("/run/openvswitch", fmt.Sprintf(".%s.succession.db", binary)),
-		podName,
-	)
+	dbOpts := databaseOptions{
+		path:           *ovsDB,
+		schema:         *ovsSchema,
+		backups:        *ovsDBBackups,
+		restoreBackup:  *ovsDBRestoreBackup,
+		clusterLocal:   *ovsDBClusterLocal,
+		clusterRemotes: splitList(*ovsDBClusterRemotes),
+		endpoints:      splitList(*ovsDBEndpoints),
+	}
+
+	dbOpts.tlsConfig, err = databaseTLS(*ovsDBPrivateKey, *ovsDBCertificate, *ovsDBCACert, dbOpts.endpoints)
+	if err != nil {
+		slog.Error("invalid database TLS configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if err := dbOpts.validate(); err != nil {
+		slog.Error("invalid database configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if *dryRunFlag {
+		h := &handoff{profile: prof, runDir: runDir, binary: binary, pod: podName, hooks: handoffHooks, compat: compatibility, start: time.Now()}
+		os.Exit(h.dryRun(context.TODO(), binaryPath, processArgs, &dbOpts))
+	}
+
+	marker, err := newSuccessionMarker(*successionBackend, runDir, prof.name, podName, *successionMaxHistory, logger.Handler())
 	if err != nil {
 		slog.Error("failed to create succession marker", "error", err)
 		os.Exit(1)
@@ -97,8 +214,24 @@ func main() {
 			slog.Error("failed to close marker", "error", err)
 		}
 	}()
+	marker.SetTTL(*successionTTL)
 
+	var restartStart time.Time
+	h := &handoff{profile: prof, runDir: runDir, binary: binary, pod: podName, hooks: handoffHooks, compat: compatibility, start: time.Now()}
+	stopRenewing := func() {}
+
+	// finish records the final outcome of the handoff, the saved flows are
+	// only of use to the flow restore started right before exec
+	finish := func(outcome string) {
+		h.discardFlows()
+		recordOutcome(marker, outcome, restartStart)
+		h.writeMetrics(outcome, marker.Token(), restartStart)
+		h.writeReport(outcome, marker.Token(), restartStart)
+	}
+
+	endCheck := h.startPhase("succession-check")
 	shouldProceed, wasReplaced, err := marker.CheckSuccession(context.TODO())
+	endCheck(err)
 	if err != nil {
 		slog.Warn("failed to check succession", "error", err)
 		shouldProceed = true
@@ -124,97 +257,185 @@ func main() {
 		os.Exit(1)
 	}
 
-	var restartStart time.Time
+	claimInfo := succession.ClaimInfo{
+		Node:  os.Getenv("NODE_NAME"),
+		Image: os.Getenv("POD_IMAGE"),
+	}
+
+	claim := func() {
+		if err := h.runHooks(context.TODO(), hooks.PHASE_PRE_CLAIM); err != nil {
+			slog.Error("hook failed", "error", err)
+			finish(succession.OUTCOME_HOOK_FAILED)
+			os.Exit(1)
+		}
+
+		endClaim := h.startPhase("claim")
+		var err error
+		stopRenewing, err = claimSuccession(marker, claimInfo, podName)
+		endClaim(err)
+		if err != nil {
+			slog.Warn("failed to claim succession", "error", err)
+		}
+	}
+
+	// Get the version of the new binary before stopping the existing
+	// process, so it does not add to the handoff
+	if incoming, err := binaryVersion(context.TODO(), binaryPath); err != nil {
+		slog.Warn("failed to get version of new process", "error", err)
+	} else {
+		h.incomingVersion = incoming.Version
+	}
+
+	endConnect := h.startPhase("connect")
+	client, err := dialDaemon(prof, runDir)
+	endConnect(err)
 
-	client, err := appctl.DialBinary(binary)
 	switch {
 	case errors.Is(err, appctl.ErrNoPidFile):
 		slog.Info("no existing process found")
 
-		if err := marker.Claim(context.TODO()); err != nil {
-			slog.Warn("failed to claim succession", "error", err)
-		} else {
-			slog.Info("claimed succession", "pod", podName)
-		}
-	case err != nil:
-		slog.Error("failed to connect to process, assuming dead, cleaning up.", "error", err)
-		if err := appctl.Cleanup(binary); err != nil {
+		claim()
+	case errors.Is(err, appctl.ErrUnreachable):
+		slog.Error("existing process is running but unreachable", "error", err)
+		os.Exit(1)
+	case errors.Is(err, appctl.ErrPidNamespace):
+		slog.Error("existing process is not visible, the pod needs hostPID or to share the process namespace of the daemon", "error", err)
+		os.Exit(1)
+	case errors.Is(err, appctl.ErrStalePidFile):
+		slog.Info("existing process is not running, cleaning up", "error", err)
+		if err := appctl.CleanupDaemon(runDir, prof.name, prof.binary); err != nil {
 			slog.Error("failed to clean up", "error", err)
+			finish(succession.OUTCOME_CLEANUP_FAILED)
 			os.Exit(1)
 		}
 		slog.Info("cleaned up stale process files")
 
-		if err := marker.Claim(context.TODO()); err != nil {
-			slog.Warn("failed to claim succession", "error", err)
-		} else {
-			slog.Info("claimed succession", "pod", podName)
-		}
-
+		claim()
+	case err != nil:
+		slog.Error("failed to find existing process", "error", err)
+		os.Exit(1)
 	default:
 		defer func() {
 			if err := client.Close(); err != nil {
 				slog.Error("failed to close client", "error", err)
 			}
 		}()
+		h.client = client
 
-		var version string
-		err = client.CallWithContext(context.TODO(), "version", []string{}, &version)
+		endVersion := h.startPhase("version")
+		version, err := client.Version(context.TODO())
+		endVersion(err)
 		if err != nil {
 			slog.Error("failed to get version", "error", err)
+			finish(succession.OUTCOME_VERSION_FAILED)
 			os.Exit(1)
 		}
 
-		version = strings.TrimSuffix(version, "\n")
-		slog.Info("stopping existing process", "version", version)
+		claimInfo.ReplacedVersion = version.Version
+		h.replacedVersion = version.Version
 
-		if err := marker.Claim(context.TODO()); err != nil {
-			slog.Warn("failed to claim succession", "error", err)
-		} else {
-			slog.Info("claimed succession", "pod", podName)
+		endCompat := h.startPhase("compatibility")
+		err = h.checkCompatibility(context.TODO(), &dbOpts)
+		endCompat(err)
+		if err != nil {
+			slog.Error("refusing to replace existing process", "version", version.Version, "incoming_version", h.incomingVersion, "error", err)
+			finish(succession.OUTCOME_INCOMPATIBLE)
+			os.Exit(1)
+		}
 
-			if history, err := marker.GetHistory(context.TODO()); err == nil && len(history) > 1 {
-				slog.Debug("succession history updated",
-					"new_owner", history[0].Owner,
-					"previous_owner", history[1].Owner,
-					"total_entries", len(history))
-			}
+		slog.Info("stopping existing process", "version", version.Version)
+
+		claim()
+		if history, err := marker.GetHistory(context.TODO()); err == nil && len(history) > 1 {
+			slog.Debug("succession history updated",
+				"new_owner", history[0].Owner,
+				"previous_owner", history[1].Owner,
+				"total_entries", len(history))
 		}
 
-		restartStart = time.Now()
-		err = client.Exit(context.TODO(), binary)
-		if err != nil {
-			slog.Error("failed to stop existing process", "error", err)
+		if err := h.runHooks(context.TODO(), hooks.PHASE_PRE_EXIT); err != nil {
+			slog.Error("hook failed", "error", err)
+			finish(succession.OUTCOME_HOOK_FAILED)
 			os.Exit(1)
 		}
 
-		verifiers := []verifier.Verifier{
-			verifier.FileRemoval(fmt.Sprintf("%s/%s.pid", appctl.RUN_DIR, binary)),
-			verifier.FileRemoval(fmt.Sprintf("%s/%s.*.ctl", appctl.RUN_DIR, binary)),
+		endPreExit := h.startPhase("pre-exit")
+		err = h.runPreExit(context.TODO())
+		endPreExit(err)
+		if err != nil {
+			slog.Error("failed to prepare existing process to exit", "error", err)
+			finish(succession.OUTCOME_PRE_EXIT_FAILED)
+			os.Exit(1)
 		}
 
-		if binary == "ovs-vswitchd" {
-			verifiers = append(verifiers, verifier.HugePages())
+		checkClaim(marker, h.discardFlows)
+
+		restartStart = time.Now()
+		endExit := h.startPhase("exit")
+		err = h.exit(context.TODO())
+		endExit(err)
+		if err != nil {
+			slog.Error("failed to stop existing process", "error", err)
+			finish(succession.OUTCOME_EXIT_FAILED)
+			os.Exit(1)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), *verifyTimeout)
 		defer cancel()
 
-		err = verifier.Run(ctx, verifiers...)
+		results, err := verifier.RunWithResults(ctx, prof.exitVerifiers(runDir, client.Process)...)
+		h.recordVerifiers(results)
 		if err != nil {
 			slog.Error("verification after exit failed", "error", err)
+			finish(succession.OUTCOME_VERIFY_FAILED)
 			os.Exit(1)
 		}
 
 		slog.Info("stopped existing process")
+
+		if err := h.runHooks(context.TODO(), hooks.PHASE_POST_EXIT); err != nil {
+			slog.Error("hook failed", "error", err)
+			finish(succession.OUTCOME_HOOK_FAILED)
+			os.Exit(1)
+		}
 	}
 
 	if *ovsDB != "" {
-		if err := initializeOVSDatabase(*ovsDB, *ovsSchema); err != nil {
+		endDatabase := h.startPhase("database")
+		err := initializeOVSDatabase(context.TODO(), dbOpts)
+		endDatabase(err)
+		if err != nil {
 			slog.Error("failed to initialize OVS database", "error", err)
+			finish(succession.OUTCOME_DATABASE_FAILED)
 			os.Exit(1)
 		}
 	}
 
+	if err := h.runHooks(context.TODO(), hooks.PHASE_PRE_EXEC); err != nil {
+		slog.Error("hook failed", "error", err)
+		finish(succession.OUTCOME_HOOK_FAILED)
+		os.Exit(1)
+	}
+
+	endExec := h.startPhase("exec")
+	checkClaim(marker, h.discardFlows)
+
+	if h.flowsDir != "" {
+		if err := startFlowRestore(context.TODO(), runDir, h.flowsDir); err != nil {
+			slog.Error("failed to start flow restore, clearing flow-restore-wait", "error", err)
+			h.discardFlows()
+
+			if err := setRestoreWait(context.TODO(), runDir, false); err != nil {
+				slog.Error("failed to clear flow-restore-wait", "error", err)
+				finish(succession.OUTCOME_EXEC_FAILED)
+				os.Exit(1)
+			}
+		} else {
+			// The flow restore owns the saved flows from now on
+			h.flowsDir = ""
+		}
+	}
+
 	if !restartStart.IsZero() {
 		restartDuration := time.Since(restartStart)
 		slog.Info("restarting process", "restart_duration_ms", restartDuration.Milliseconds())
@@ -222,9 +443,24 @@ func main() {
 		slog.Info("starting process")
 	}
 
+	stopRenewing()
+	endExec(nil)
+	finish(succession.OUTCOME_EXEC)
+
+	if *superviseFlag {
+		code, err := h.supervise(marker, binaryPath, processArgs)
+		if err != nil {
+			slog.Error("failed to start process", "error", err)
+			finish(succession.OUTCOME_EXEC_FAILED)
+			os.Exit(1)
+		}
+		os.Exit(code)
+	}
+
 	err = syscall.Exec(binaryPath, append([]string{binaryPath}, processArgs...), os.Environ())
 	if err != nil {
 		slog.Error("failed to exec process", "error", err)
+		finish(succession.OUTCOME_EXEC_FAILED)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/vexxhost/ovsinit/pkg/succession"
+)
+
+const (
+	SUCCESSION_BACKEND_SQLITE = "sqlite"
+	SUCCESSION_BACKEND_LEASE  = "lease"
+)
+
+func successionDBPath(runDir, binary string) string {
+	return filepath.Join(runDir, fmt.Sprintf(".%s.succession.db", binary))
+}
+
+// newSuccessionMarker creates the succession marker for binary using the
+// selected backend, logging to handler.  Leases are scoped to the node since
+// the daemons are.
+func newSuccessionMarker(backend, runDir, binary, podName string, maxHistory int, handler slog.Handler) (*succession.Marker, error) {
+	switch backend {
+	case SUCCESSION_BACKEND_SQLITE:
+		sqlite, err := succession.NewSQLiteBackend(successionDBPath(runDir, binary), handler)
+		if err != nil {
+			return nil, err
+		}
+		sqlite.SetMaxHistory(maxHistory)
+
+		return succession.NewWithBackend(sqlite, podName), nil
+	case SUCCESSION_BACKEND_LEASE:
+		lease, err := newLeaseBackend(binary)
+		if err != nil {
+			return nil, err
+		}
+		lease.SetMaxHistory(maxHistory)
+
+		return succession.NewWithBackend(lease, podName), nil
+	default:
+		return nil, fmt.Errorf("unknown succession backend %q", backend)
+	}
+}
+
+// openSuccessionMarker opens the succession marker for binary without
+// creating or migrating anything, for inspecting it only.  A SQLite
+// database which does not exist fails with fs.ErrNotExist.
+func openSuccessionMarker(backend, runDir, binary, podName string, handler slog.Handler) (*succession.Marker, error) {
+	switch backend {
+	case SUCCESSION_BACKEND_SQLITE:
+		sqlite, err := succession.OpenSQLiteBackend(successionDBPath(runDir, binary), handler)
+		if err != nil {
+			return nil, err
+		}
+
+		return succession.NewWithBackend(sqlite, podName), nil
+	case SUCCESSION_BACKEND_LEASE:
+		lease, err := newLeaseBackend(binary)
+		if err != nil {
+			return nil, err
+		}
+
+		return succession.NewWithBackend(lease, podName), nil
+	default:
+		return nil, fmt.Errorf("unknown succession backend %q", backend)
+	}
+}
+
+func newLeaseBackend(binary string) (*succession.LeaseBackend, error) {
+	namespace := os.Getenv("POD_NAMESPACE")
+	nodeName := os.Getenv("NODE_NAME")
+	if namespace == "" || nodeName == "" {
+		return nil, fmt.Errorf("POD_NAMESPACE and NODE_NAME environment variables must be set for the %s backend", SUCCESSION_BACKEND_LEASE)
+	}
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return succession.NewLeaseBackend(client, namespace, succession.LeaseName(binary, nodeName)), nil
+}
+
+// recordOutcome records the outcome of the handoff on our claim, timed from
+// when the existing process was asked to exit.
+func recordOutcome(marker *succession.Marker, outcome string, start time.Time) {
+	var duration time.Duration
+	if !start.IsZero() {
+		duration = time.Since(start)
+	}
+
+	err := marker.RecordOutcome(context.TODO(), outcome, duration)
+	switch {
+	case err == nil:
+	case errors.Is(err, succession.ErrNotClaimed):
+		slog.Debug("no succession claim to record the outcome on", "outcome", outcome)
+	default:
+		slog.Warn("failed to record succession outcome", "outcome", outcome, "error", err)
+	}
+}
+
+// claimSuccession claims ownership and keeps renewing the claim until the
+// returned function is called, which must happen before recording the final
+// outcome.
+func claimSuccession(marker *succession.Marker, info succession.ClaimInfo, podName string) (func(), error) {
+	if err := marker.ClaimWithInfo(context.TODO(), info); err != nil {
+		return func() {}, err
+	}
+
+	slog.Info("claimed succession", "pod", podName, "token", marker.Token())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if err := marker.KeepAlive(ctx); err != nil {
+			slog.Error("stopped renewing succession claim", "error", err)
+		}
+	})
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}, nil
+}
+
+// checkClaim exits if our claim was superseded while handing off, since the
+// new owner must not be interfered with, calling release first to let go of
+// whatever the handoff holds.
+func checkClaim(marker *succession.Marker, release func()) {
+	err := marker.Validate(context.TODO())
+	switch {
+	case err == nil, errors.Is(err, succession.ErrNotClaimed):
+	case errors.Is(err, succession.ErrFenced):
+		slog.Info("succession claim superseded, exiting gracefully", "error", err)
+		release()
+		os.Exit(0)
+	default:
+		slog.Warn("failed to validate succession claim", "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/metrics"
+)
+
+// writeMetrics writes the metrics of the handoff to the textfile, if one is
+// configured.  Failing to do so must not fail the handoff.
+func (h *handoff) writeMetrics(outcome string, generation uint, restartStart time.Time) {
+	if *metricsFile == "" {
+		return
+	}
+
+	if err := metrics.WriteTextfile(*metricsFile, h.handoffMetrics(outcome, generation, restartStart)); err != nil {
+		slog.Warn("failed to write metrics", "path", *metricsFile, "error", err)
+	}
+}
+
+// handoffMetrics returns the metrics of the handoff once it finished with
+// outcome, handing off the succession claim with token generation.
+func (h *handoff) handoffMetrics(outcome string, generation uint, restartStart time.Time) []metrics.Family {
+	labels := func(extra map[string]string) map[string]string {
+		labels := map[string]string{"daemon": h.profile.name}
+		for name, value := range extra {
+			labels[name] = value
+		}
+		return labels
+	}
+
+	phases := metrics.Family{
+		Name: "ovsinit_handoff_phase_duration_seconds",
+		Help: "Duration of each phase of the last handoff.",
+		Type: metrics.TYPE_GAUGE,
+	}
+	for _, p := range h.phases {
+		phases.Samples = append(phases.Samples, metrics.Sample{
+			Labels: labels(map[string]string{"phase": p.name}),
+			Value:  p.duration().Seconds(),
+		})
+	}
+
+	var restartDuration time.Duration
+	if !restartStart.IsZero() {
+		restartDuration = time.Since(restartStart)
+	}
+
+	families := []metrics.Family{
+		phases,
+		{
+			Name:    "ovsinit_handoff_duration_seconds",
+			Help:    "Time from asking the existing daemon to exit until the new one was started, 0 when none was running.",
+			Type:    metrics.TYPE_GAUGE,
+			Samples: []metrics.Sample{{Labels: labels(nil), Value: restartDuration.Seconds()}},
+		},
+		{
+			Name:    "ovsinit_handoff_outcome",
+			Help:    "Outcome of the last handoff.",
+			Type:    metrics.TYPE_GAUGE,
+			Samples: []metrics.Sample{{Labels: labels(map[string]string{"outcome": outcome}), Value: 1}},
+		},
+		{
+			Name:    "ovsinit_handoff_timestamp_seconds",
+			Help:    "Unix time the last handoff finished.",
+			Type:    metrics.TYPE_GAUGE,
+			Samples: []metrics.Sample{{Labels: labels(nil), Value: float64(time.Now().UnixMilli()) / 1000}},
+		},
+		{
+			Name:    "ovsinit_succession_generation",
+			Help:    "Fencing token of the succession claim of the last handoff.",
+			Type:    metrics.TYPE_GAUGE,
+			Samples: []metrics.Sample{{Labels: labels(nil), Value: float64(generation)}},
+		},
+	}
+
+	versions := metrics.Family{
+		Name: "ovsinit_daemon_version_info",
+		Help: "Version of the daemon replaced and started by the last handoff.",
+		Type: metrics.TYPE_GAUGE,
+	}
+	roles := []struct{ role, version string }{
+		{"replaced", h.replacedVersion},
+		{"incoming", h.incomingVersion},
+	}
+	for _, r := range roles {
+		if r.version != "" {
+			versions.Samples = append(versions.Samples, metrics.Sample{
+				Labels: labels(map[string]string{"role": r.role, "version": r.version}),
+				Value:  1,
+			})
+		}
+	}
+	if len(versions.Samples) > 0 {
+		families = append(families, versions)
+	}
+
+	return families
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+	"github.com/vexxhost/ovsinit/pkg/verifier"
+)
+
+// phase is a timed part of the handoff
+type phase struct {
+	name  string
+	start time.Time
+	end   time.Time
+	err   error
+}
+
+func (p phase) duration() time.Duration {
+	return p.end.Sub(p.start)
+}
+
+// startPhase starts timing a phase, which ends when the returned function
+// is called with its error.
+func (h *handoff) startPhase(name string) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		h.phases = append(h.phases, phase{
+			name:  name,
+			start: start,
+			end:   time.Now(),
+			err:   err,
+		})
+	}
+}
+
+// recordVerifiers records a phase for each verifier run after the exit
+func (h *handoff) recordVerifiers(results []verifier.Result) {
+	for _, result := range results {
+		h.phases = append(h.phases, phase{
+			name:  fmt.Sprintf("verify:%s", result.Name),
+			start: result.Start,
+			end:   result.End,
+			err:   result.Err,
+		})
+	}
+}
+
+// binaryVersion returns the version of the binary about to be exec'd,
+// giving up after VERSION_TIMEOUT
+func binaryVersion(ctx context.Context, path string) (*appctl.Version, error) {
+	ctx, cancel := context.WithTimeout(ctx, VERSION_TIMEOUT)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, "--version")
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s --version: %w", path, err)
+	}
+
+	return appctl.ParseVersion(string(output))
+}
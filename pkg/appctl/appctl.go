@@ -1,26 +1,77 @@
 package appctl
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cenkalti/rpc2"
 	"github.com/cenkalti/rpc2/jsonrpc"
 )
 
 const (
-	RUN_DIR = "/run/openvswitch"
+	RUN_DIR     = "/run/openvswitch"
+	OVN_RUN_DIR = "/run/ovn"
 )
 
+// ErrNoPidFile is returned when the process is not running
 var ErrNoPidFile = errors.New("pid file does not exist")
 
+// RunDir returns the directory binary keeps its pid file and control socket
+// in, honouring OVN_RUNDIR for OVN daemons and OVS_RUNDIR for the others.
+func RunDir(binary string) string {
+	if strings.HasPrefix(binary, "ovn-") {
+		return OVNRunDir()
+	}
+
+	return OVSRunDir()
+}
+
+// OVSRunDir returns the run directory of the OVS daemons
+func OVSRunDir() string {
+	if dir := os.Getenv("OVS_RUNDIR"); dir != "" {
+		return dir
+	}
+
+	return RUN_DIR
+}
+
+// OVNRunDir returns the run directory of the OVN daemons and databases
+func OVNRunDir() string {
+	if dir := os.Getenv("OVN_RUNDIR"); dir != "" {
+		return dir
+	}
+
+	return OVN_RUN_DIR
+}
+
+// PidFile returns the path of the pid file of binary
+func PidFile(runDir, binary string) string {
+	return filepath.Join(runDir, fmt.Sprintf("%s.pid", binary))
+}
+
+// SocketPattern returns the glob pattern matching the control sockets of
+// binary, which are named after its pid
+func SocketPattern(runDir, binary string) string {
+	return filepath.Join(runDir, fmt.Sprintf("%s.*.ctl", binary))
+}
+
+// FixedSocket returns the path of the control socket of a daemon started
+// with --unixctl, such as the OVN databases, which has no pid in its name
+func FixedSocket(runDir, name string) string {
+	return filepath.Join(runDir, fmt.Sprintf("%s.ctl", name))
+}
+
 type Client struct {
 	*rpc2.Client
+
+	// Process is the process the client is connected to, only set by
+	// DialBinary
+	Process *Process
 }
 
 func NewClient(conn io.ReadWriteCloser) *Client {
@@ -34,7 +85,12 @@ func NewClient(conn io.ReadWriteCloser) *Client {
 }
 
 func (c *Client) Close() error {
-	return c.Client.Close()
+	err := c.Client.Close()
+	if c.Process != nil {
+		err = errors.Join(err, c.Process.Close())
+	}
+
+	return err
 }
 
 func Dial(network, address string) (*Client, error) {
@@ -46,37 +102,108 @@ func Dial(network, address string) (*Client, error) {
 	return NewClient(conn), nil
 }
 
-func DialBinary(binary string) (*Client, error) {
-	path := fmt.Sprintf("%s/%s.pid", RUN_DIR, binary)
-	bytes, err := os.ReadFile(path)
+// DialBinary connects to the control socket of the running binary, failing
+// with ErrNoPidFile or ErrStalePidFile when it is not running, ErrUnreachable
+// when it is running but the socket cannot be dialed and ErrPidNamespace
+// when its process is not visible.
+func DialBinary(runDir, binary string) (*Client, error) {
+	return dialBinary(runDir, PROC_DIR, binary)
+}
+
+// DialDaemon is like DialBinary for a daemon whose pid file and control
+// socket are named after name instead of its binary, such as ovnnb_db.
+func DialDaemon(runDir, name, binary string) (*Client, error) {
+	return dialDaemon(runDir, PROC_DIR, name, binary)
+}
+
+// DialSocket connects to the control socket of name without looking for its
+// process, which is not visible from another pid namespace such as the one
+// of a sidecar.  It prefers the socket named after the pid in the pid file,
+// falling back to the first control socket of name which answers.
+func DialSocket(runDir, name string) (*Client, error) {
+	if pid, err := readPidFile(runDir, name); err == nil {
+		if client, err := Dial("unix", filepath.Join(runDir, fmt.Sprintf("%s.%d.ctl", name, pid))); err == nil {
+			return client, nil
+		}
+	}
+
+	path, ok := answeringSocket(runDir, name)
+	if !ok {
+		return nil, fmt.Errorf("%w: no control socket of %s answers in %s", ErrUnreachable, name, runDir)
+	}
+
+	return Dial("unix", path)
+}
+
+func dialBinary(runDir, procDir, binary string) (*Client, error) {
+	return dialDaemon(runDir, procDir, binary, binary)
+}
+
+func dialDaemon(runDir, procDir, name, binary string) (*Client, error) {
+	process, err := findDaemon(runDir, procDir, name, binary)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrNoPidFile
+		return nil, err
+	}
+
+	path := filepath.Join(runDir, fmt.Sprintf("%s.%d.ctl", name, process.Pid))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// Daemons started with --unixctl use a socket without the pid
+		if _, err := os.Stat(FixedSocket(runDir, name)); err == nil {
+			path = FixedSocket(runDir, name)
 		}
-		return nil, fmt.Errorf("failed to read pid file %s: %w", path, err)
 	}
 
-	var pid int
-	_, err = fmt.Sscanf(string(bytes), "%d", &pid)
+	client, err := Dial("unix", path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse pid from %s: %w", path, err)
+		_ = process.Close()
+		return nil, fmt.Errorf("%w: %s (pid %d): %w", ErrUnreachable, name, process.Pid, err)
 	}
 
-	path = fmt.Sprintf("%s/%s.%d.ctl", RUN_DIR, binary, pid)
-	return Dial("unix", path)
+	client.Process = process
+	return client, nil
+}
+
+// Cleanup removes the pid file and control sockets left behind by binary,
+// refusing to do so while it is still running, or while one of its control
+// sockets answers.
+func Cleanup(runDir, binary string) error {
+	return cleanup(runDir, PROC_DIR, binary)
+}
+
+// CleanupDaemon is like Cleanup for a daemon whose pid file and control
+// socket are named after name instead of its binary.
+func CleanupDaemon(runDir, name, binary string) error {
+	return cleanupDaemon(runDir, PROC_DIR, name, binary)
 }
 
-func Cleanup(binary string) error {
-	pidPath := fmt.Sprintf("%s/%s.pid", RUN_DIR, binary)
+func cleanup(runDir, procDir, binary string) error {
+	return cleanupDaemon(runDir, procDir, binary, binary)
+}
+
+func cleanupDaemon(runDir, procDir, name, binary string) error {
+	process, err := findDaemon(runDir, procDir, name, binary)
+	switch {
+	case err == nil:
+		_ = process.Close()
+		return fmt.Errorf("%w: %s (pid %d)", ErrRunning, name, process.Pid)
+	case errors.Is(err, ErrPidNamespace):
+		return fmt.Errorf("%w: %w", ErrRunning, err)
+	case errors.Is(err, ErrNoPidFile), errors.Is(err, ErrStalePidFile):
+	default:
+		return err
+	}
+
+	pidPath := PidFile(runDir, name)
 	if err := os.Remove(pidPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove pid file %s: %w", pidPath, err)
 	}
 
-	socketPath := fmt.Sprintf("%s/%s.*.ctl", RUN_DIR, binary)
+	socketPath := SocketPattern(runDir, name)
 	matches, err := filepath.Glob(socketPath)
 	if err != nil {
 		return fmt.Errorf("failed to glob socket files %s: %w", socketPath, err)
 	}
+	matches = append(matches, FixedSocket(runDir, name))
 
 	for _, match := range matches {
 		if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
@@ -86,7 +213,3 @@ func Cleanup(binary string) error {
 
 	return nil
 }
-
-func (c *Client) Exit(ctx context.Context, binary string) error {
-	return c.CallWithContext(ctx, "exit", []string{}, nil)
-}
@@ -0,0 +1,783 @@
+package appctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cenkalti/rpc2"
+)
+
+// CommandError is returned when the daemon ran a command and replied with an
+// error, as opposed to failing to talk to it
+type CommandError struct {
+	Command string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Message)
+}
+
+// Run runs a unixctl command and returns its text reply as is
+func (c *Client) Run(ctx context.Context, command string, args ...string) (string, error) {
+	if args == nil {
+		args = []string{}
+	}
+
+	var reply string
+	err := c.CallWithContext(ctx, command, args, &reply)
+
+	var serverErr rpc2.ServerError
+	if errors.As(err, &serverErr) {
+		return "", &CommandError{
+			Command: command,
+			Message: strings.TrimSuffix(string(serverErr), "\n"),
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", command, err)
+	}
+
+	return reply, nil
+}
+
+// lines splits a reply into its non-empty lines
+func lines(reply string) []string {
+	var result []string
+	for _, line := range strings.Split(reply, "\n") {
+		if strings.TrimSpace(line) != "" {
+			result = append(result, line)
+		}
+	}
+
+	return result
+}
+
+// Version is the reply of the version command
+type Version struct {
+	Program string
+	Package string
+	Version string
+
+	// Libraries are the versions of the libraries, such as DPDK, reported
+	// on the following lines
+	Libraries map[string]string
+}
+
+var versionPattern = regexp.MustCompile(`^(\S+) \(([^)]+)\) (\S+)`)
+
+// ParseVersion parses the reply of the version command, which is also what
+// the daemons print with --version
+func ParseVersion(reply string) (*Version, error) {
+	return parseVersion(reply)
+}
+
+func parseVersion(reply string) (*Version, error) {
+	replyLines := lines(reply)
+	if len(replyLines) == 0 {
+		return nil, fmt.Errorf("empty version reply")
+	}
+
+	match := versionPattern.FindStringSubmatch(replyLines[0])
+	if match == nil {
+		return nil, fmt.Errorf("unexpected version reply %q", replyLines[0])
+	}
+
+	version := &Version{
+		Program:   match[1],
+		Package:   match[2],
+		Version:   match[3],
+		Libraries: map[string]string{},
+	}
+
+	for _, line := range replyLines[1:] {
+		if name, value, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			version.Libraries[name] = value
+		}
+	}
+
+	return version, nil
+}
+
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	reply, err := c.Run(ctx, "version")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseVersion(reply)
+}
+
+// Command is a unixctl command supported by a daemon
+type Command struct {
+	Name  string
+	Usage string
+}
+
+func parseListCommands(reply string) []Command {
+	var commands []Command
+	for _, line := range lines(reply) {
+		// Commands are indented below the heading
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		name, usage, _ := strings.Cut(strings.TrimSpace(line), " ")
+		commands = append(commands, Command{
+			Name:  name,
+			Usage: strings.TrimSpace(usage),
+		})
+	}
+
+	return commands
+}
+
+func (c *Client) ListCommands(ctx context.Context) ([]Command, error) {
+	reply, err := c.Run(ctx, "list-commands")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseListCommands(reply), nil
+}
+
+// VlogModule is the log levels of a module by destination
+type VlogModule struct {
+	Name   string
+	Levels map[string]string
+}
+
+func parseVlogList(reply string) ([]VlogModule, error) {
+	replyLines := lines(reply)
+	if len(replyLines) < 2 {
+		return nil, fmt.Errorf("unexpected vlog/list reply %q", reply)
+	}
+
+	destinations := strings.Fields(replyLines[0])
+
+	var modules []VlogModule
+	for _, line := range replyLines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != len(destinations)+1 || strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+
+		module := VlogModule{
+			Name:   fields[0],
+			Levels: make(map[string]string, len(destinations)),
+		}
+		for i, destination := range destinations {
+			module.Levels[destination] = fields[i+1]
+		}
+
+		modules = append(modules, module)
+	}
+
+	return modules, nil
+}
+
+func (c *Client) VlogList(ctx context.Context) ([]VlogModule, error) {
+	reply, err := c.Run(ctx, "vlog/list")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseVlogList(reply)
+}
+
+// VlogSet changes log levels using specs such as "dpif:file:dbg"
+func (c *Client) VlogSet(ctx context.Context, specs ...string) error {
+	_, err := c.Run(ctx, "vlog/set", specs...)
+	return err
+}
+
+// MemoryUsage is the count of objects by kind reported by memory/show
+type MemoryUsage map[string]int64
+
+func parseMemoryShow(reply string) (MemoryUsage, error) {
+	usage := MemoryUsage{}
+
+	// Names can contain spaces, such as "udpif keys:10"
+	var name []string
+	for _, field := range strings.Fields(reply) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			name = append(name, field)
+			continue
+		}
+
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse memory usage %q: %w", field, err)
+		}
+
+		usage[strings.Join(append(name, key), " ")] = count
+		name = nil
+	}
+
+	return usage, nil
+}
+
+func (c *Client) MemoryShow(ctx context.Context) (MemoryUsage, error) {
+	reply, err := c.Run(ctx, "memory/show")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMemoryShow(reply)
+}
+
+// CoverageCounter is the rate of an event per second averaged over the last
+// 5 seconds, minute and hour, and its total count
+type CoverageCounter struct {
+	Name       string
+	Rate5s     float64
+	RateMinute float64
+	RateHour   float64
+	Total      uint64
+}
+
+type Coverage struct {
+	Hash     string
+	Counters []CoverageCounter
+
+	// NeverHit is the number of events which never happened
+	NeverHit int
+}
+
+var (
+	coverageHashPattern     = regexp.MustCompile(`hash=([0-9a-f]+)`)
+	coverageCounterPattern  = regexp.MustCompile(`^(\S+)\s+([0-9.]+)/sec\s+([0-9.]+)/sec\s+([0-9.]+)/sec\s+total: (\d+)$`)
+	coverageNeverHitPattern = regexp.MustCompile(`^(\d+) events never hit$`)
+)
+
+func parseCoverageShow(reply string) (*Coverage, error) {
+	coverage := &Coverage{}
+
+	for _, line := range lines(reply) {
+		line = strings.TrimSpace(line)
+
+		if match := coverageHashPattern.FindStringSubmatch(line); match != nil {
+			coverage.Hash = match[1]
+			continue
+		}
+
+		if match := coverageNeverHitPattern.FindStringSubmatch(line); match != nil {
+			coverage.NeverHit, _ = strconv.Atoi(match[1])
+			continue
+		}
+
+		match := coverageCounterPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		counter := CoverageCounter{Name: match[1]}
+		counter.Rate5s, _ = strconv.ParseFloat(match[2], 64)
+		counter.RateMinute, _ = strconv.ParseFloat(match[3], 64)
+		counter.RateHour, _ = strconv.ParseFloat(match[4], 64)
+		counter.Total, _ = strconv.ParseUint(match[5], 10, 64)
+
+		coverage.Counters = append(coverage.Counters, counter)
+	}
+
+	return coverage, nil
+}
+
+func (c *Client) CoverageShow(ctx context.Context) (*Coverage, error) {
+	reply, err := c.Run(ctx, "coverage/show")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCoverageShow(reply)
+}
+
+// DpifPort is a port of a bridge with its OpenFlow and datapath port
+// numbers, which are "none" for ports without one
+type DpifPort struct {
+	Name    string
+	OFPort  string
+	DPPort  string
+	Type    string
+	Options map[string]string
+}
+
+type DpifBridge struct {
+	Name  string
+	Ports []DpifPort
+}
+
+type Datapath struct {
+	Name    string
+	Hit     uint64
+	Missed  uint64
+	Bridges []DpifBridge
+}
+
+var (
+	dpifDatapathPattern = regexp.MustCompile(`^(\S+): hit:(\d+) missed:(\d+)`)
+	dpifPortPattern     = regexp.MustCompile(`^(\S+) (\S+)/(\S+):(?: \((.*)\))?$`)
+)
+
+// parsePortType parses "internal" or "patch: peer=patch-int" into the type
+// of a port and its options
+func parsePortType(description string) (string, map[string]string) {
+	portType, rest, _ := strings.Cut(description, ":")
+
+	options := map[string]string{}
+	for _, option := range strings.Split(rest, ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(option), "="); ok {
+			options[key] = value
+		}
+	}
+
+	return portType, options
+}
+
+func parseDpifShow(reply string) ([]Datapath, error) {
+	var datapaths []Datapath
+
+	for _, line := range lines(reply) {
+		trimmed := strings.TrimSpace(line)
+
+		if match := dpifDatapathPattern.FindStringSubmatch(line); match != nil {
+			datapath := Datapath{Name: match[1]}
+			datapath.Hit, _ = strconv.ParseUint(match[2], 10, 64)
+			datapath.Missed, _ = strconv.ParseUint(match[3], 10, 64)
+
+			datapaths = append(datapaths, datapath)
+			continue
+		}
+
+		if len(datapaths) == 0 {
+			return nil, fmt.Errorf("unexpected dpif/show line %q", line)
+		}
+		datapath := &datapaths[len(datapaths)-1]
+
+		if name, ok := strings.CutSuffix(trimmed, ":"); ok && !strings.Contains(name, " ") {
+			datapath.Bridges = append(datapath.Bridges, DpifBridge{Name: name})
+			continue
+		}
+
+		match := dpifPortPattern.FindStringSubmatch(trimmed)
+		if match == nil || len(datapath.Bridges) == 0 {
+			return nil, fmt.Errorf("unexpected dpif/show line %q", line)
+		}
+		bridge := &datapath.Bridges[len(datapath.Bridges)-1]
+
+		port := DpifPort{
+			Name:   match[1],
+			OFPort: match[2],
+			DPPort: match[3],
+		}
+		port.Type, port.Options = parsePortType(match[4])
+
+		bridge.Ports = append(bridge.Ports, port)
+	}
+
+	return datapaths, nil
+}
+
+func (c *Client) DpifShow(ctx context.Context) ([]Datapath, error) {
+	reply, err := c.Run(ctx, "dpif/show")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDpifShow(reply)
+}
+
+// DatapathFlow is a flow installed in the datapath
+type DatapathFlow struct {
+	UFID    string
+	Match   string
+	Packets uint64
+	Bytes   uint64
+	Used    string
+	Flags   string
+	Actions string
+}
+
+func parseDatapathFlow(line string) (DatapathFlow, error) {
+	var flow DatapathFlow
+
+	if rest, ok := strings.CutPrefix(line, "ufid:"); ok {
+		flow.UFID, line, _ = strings.Cut(rest, ", ")
+	}
+
+	match, stats, ok := strings.Cut(line, ", packets:")
+	if !ok {
+		return flow, fmt.Errorf("unexpected datapath flow %q", line)
+	}
+	flow.Match = match
+
+	// Actions are last and can contain commas, only followed by the extra
+	// info of the userspace datapath when verbose
+	stats, actions, _ := strings.Cut("packets:"+stats, ", actions:")
+	flow.Actions, _, _ = strings.Cut(actions, ", dp-extra-info:")
+
+	for _, field := range strings.Split(stats, ", ") {
+		key, value, _ := strings.Cut(field, ":")
+		switch key {
+		case "packets":
+			flow.Packets, _ = strconv.ParseUint(value, 10, 64)
+		case "bytes":
+			flow.Bytes, _ = strconv.ParseUint(value, 10, 64)
+		case "used":
+			flow.Used = value
+		case "flags":
+			flow.Flags = value
+		}
+	}
+
+	return flow, nil
+}
+
+func parseDpctlDumpFlows(reply string) ([]DatapathFlow, error) {
+	var flows []DatapathFlow
+	for _, line := range lines(reply) {
+		// The userspace datapath dumps the flows of each PMD thread and of
+		// the main thread under their own header
+		if strings.HasPrefix(line, "flow-dump from ") {
+			continue
+		}
+
+		flow, err := parseDatapathFlow(strings.TrimSpace(line))
+		if err != nil {
+			return nil, err
+		}
+
+		flows = append(flows, flow)
+	}
+
+	return flows, nil
+}
+
+// DpctlDumpFlows dumps the datapath flows, args are passed as is to
+// dpctl/dump-flows, for example to select a datapath or filter
+func (c *Client) DpctlDumpFlows(ctx context.Context, args ...string) ([]DatapathFlow, error) {
+	reply, err := c.Run(ctx, "dpctl/dump-flows", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDpctlDumpFlows(reply)
+}
+
+// Route is an entry of the routing table used for tunnels, Type is
+// "Cached" for routes learned from the kernel and "User" for others
+type Route struct {
+	Type    string
+	Prefix  string
+	Dev     string
+	Gateway string
+	Source  string
+	Mark    string
+	Local   bool
+}
+
+func parseRouteShow(reply string) ([]Route, error) {
+	var routes []Route
+
+	for _, line := range lines(reply) {
+		routeType, rest, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("unexpected route %q", line)
+		}
+
+		route := Route{
+			Type:   routeType,
+			Prefix: fields[0],
+		}
+
+		for i := 1; i < len(fields); i++ {
+			var value *string
+			switch fields[i] {
+			case "dev":
+				value = &route.Dev
+			case "GW":
+				value = &route.Gateway
+			case "SRC":
+				value = &route.Source
+			case "MARK":
+				value = &route.Mark
+			case "local":
+				route.Local = true
+				continue
+			default:
+				continue
+			}
+
+			if i+1 < len(fields) {
+				i++
+				*value = fields[i]
+			}
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+func (c *Client) RouteShow(ctx context.Context) ([]Route, error) {
+	reply, err := c.Run(ctx, "ovs/route/show")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRouteShow(reply)
+}
+
+// ClusterServer is a member of a cluster as seen by the local server
+type ClusterServer struct {
+	SID     string
+	Address string
+	Self    bool
+}
+
+// ClusterStatus is the reply of cluster/status, IDs are the full UUIDs
+type ClusterStatus struct {
+	Name      string
+	ClusterID string
+	ServerID  string
+	Address   string
+	Status    string
+	Role      string
+	Term      uint64
+	Leader    string
+	Vote      string
+	Servers   []ClusterServer
+}
+
+var (
+	clusterIDPattern     = regexp.MustCompile(`\(([0-9a-f-]+)\)`)
+	clusterServerPattern = regexp.MustCompile(`^(\S+) \((\S+) at (\S+)\)`)
+)
+
+func parseClusterStatus(reply string) (*ClusterStatus, error) {
+	status := &ClusterStatus{}
+
+	servers := false
+	for _, line := range lines(reply) {
+		if servers && strings.HasPrefix(line, " ") {
+			match := clusterServerPattern.FindStringSubmatch(strings.TrimSpace(line))
+			if match == nil {
+				return nil, fmt.Errorf("unexpected cluster server %q", line)
+			}
+
+			status.Servers = append(status.Servers, ClusterServer{
+				SID:     match[1],
+				Address: match[3],
+				Self:    strings.Contains(line, "(self)"),
+			})
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		servers = key == "Servers"
+		switch key {
+		case "Name":
+			status.Name = value
+		case "Cluster ID", "Server ID":
+			id := value
+			if match := clusterIDPattern.FindStringSubmatch(value); match != nil {
+				id = match[1]
+			}
+
+			if key == "Cluster ID" {
+				status.ClusterID = id
+			} else {
+				status.ServerID = id
+			}
+		case "Address":
+			status.Address = value
+		case "Status":
+			status.Status = value
+		case "Role":
+			status.Role = value
+		case "Term":
+			status.Term, _ = strconv.ParseUint(value, 10, 64)
+		case "Leader":
+			status.Leader = value
+		case "Vote":
+			status.Vote = value
+		}
+	}
+
+	if status.Name == "" {
+		return nil, fmt.Errorf("unexpected cluster/status reply %q", reply)
+	}
+
+	return status, nil
+}
+
+func (c *Client) ClusterStatus(ctx context.Context, db string) (*ClusterStatus, error) {
+	reply, err := c.Run(ctx, "cluster/status", db)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClusterStatus(reply)
+}
+
+func (c *Client) ClusterLeave(ctx context.Context, db string) error {
+	_, err := c.Run(ctx, "cluster/leave", db)
+	return err
+}
+
+func parseOfprotoList(reply string) []string {
+	var bridges []string
+	for _, line := range lines(reply) {
+		bridges = append(bridges, strings.TrimSpace(line))
+	}
+
+	return bridges
+}
+
+func (c *Client) OfprotoList(ctx context.Context) ([]string, error) {
+	reply, err := c.Run(ctx, "ofproto/list")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseOfprotoList(reply), nil
+}
+
+type UpcallFlows struct {
+	Current uint64
+	Avg     uint64
+	Max     uint64
+	Limit   uint64
+}
+
+// UpcallDatapath is the state of the upcall handling of a datapath, with
+// the number of keys tracked by each revalidator
+type UpcallDatapath struct {
+	Name           string
+	Flows          UpcallFlows
+	OffloadedFlows uint64
+	DumpDurationMs uint64
+	UFIDEnabled    bool
+	Revalidators   map[int]uint64
+}
+
+var (
+	upcallFlowsPattern       = regexp.MustCompile(`\(current (\d+)\) \(avg (\d+)\) \(max (\d+)\) \(limit (\d+)\)`)
+	upcallRevalidatorPattern = regexp.MustCompile(`^(\d+): \(keys (\d+)\)`)
+)
+
+func parseUpcallShow(reply string) ([]UpcallDatapath, error) {
+	var datapaths []UpcallDatapath
+
+	for _, line := range lines(reply) {
+		if !strings.HasPrefix(line, " ") {
+			datapaths = append(datapaths, UpcallDatapath{
+				Name:         strings.TrimSuffix(strings.TrimSpace(line), ":"),
+				Revalidators: map[int]uint64{},
+			})
+			continue
+		}
+
+		if len(datapaths) == 0 {
+			return nil, fmt.Errorf("unexpected upcall/show line %q", line)
+		}
+		datapath := &datapaths[len(datapaths)-1]
+
+		line = strings.TrimSpace(line)
+		if match := upcallRevalidatorPattern.FindStringSubmatch(line); match != nil {
+			id, _ := strconv.Atoi(match[1])
+			datapath.Revalidators[id], _ = strconv.ParseUint(match[2], 10, 64)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "flows":
+			if match := upcallFlowsPattern.FindStringSubmatch(value); match != nil {
+				datapath.Flows.Current, _ = strconv.ParseUint(match[1], 10, 64)
+				datapath.Flows.Avg, _ = strconv.ParseUint(match[2], 10, 64)
+				datapath.Flows.Max, _ = strconv.ParseUint(match[3], 10, 64)
+				datapath.Flows.Limit, _ = strconv.ParseUint(match[4], 10, 64)
+			}
+		case "offloaded flows":
+			datapath.OffloadedFlows, _ = strconv.ParseUint(value, 10, 64)
+		case "dump duration":
+			datapath.DumpDurationMs, _ = strconv.ParseUint(strings.TrimSuffix(value, "ms"), 10, 64)
+		case "ufid enabled":
+			datapath.UFIDEnabled = value == "true"
+		}
+	}
+
+	return datapaths, nil
+}
+
+func (c *Client) UpcallShow(ctx context.Context) ([]UpcallDatapath, error) {
+	reply, err := c.Run(ctx, "upcall/show")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseUpcallShow(reply)
+}
+
+// Exit asks the daemon to exit, leaving the datapath and its resources in
+// place for the next process to take over.
+func (c *Client) Exit(ctx context.Context) error {
+	_, err := c.Run(ctx, "exit")
+	return err
+}
+
+// ExitCleanup asks the daemon to exit and release the resources it owns,
+// such as datapath ports, for when it is not going to be restarted.
+func (c *Client) ExitCleanup(ctx context.Context) error {
+	_, err := c.Run(ctx, "exit", "--cleanup")
+	return err
+}
+
+// replyParsers parse the replies of the commands with typed wrappers
+var replyParsers = map[string]func(reply string) (any, error){
+	"version":          func(reply string) (any, error) { return parseVersion(reply) },
+	"list-commands":    func(reply string) (any, error) { return parseListCommands(reply), nil },
+	"vlog/list":        func(reply string) (any, error) { return parseVlogList(reply) },
+	"memory/show":      func(reply string) (any, error) { return parseMemoryShow(reply) },
+	"coverage/show":    func(reply string) (any, error) { return parseCoverageShow(reply) },
+	"dpif/show":        func(reply string) (any, error) { return parseDpifShow(reply) },
+	"dpctl/dump-flows": func(reply string) (any, error) { return parseDpctlDumpFlows(reply) },
+	"ovs/route/show":   func(reply string) (any, error) { return parseRouteShow(reply) },
+	"cluster/status":   func(reply string) (any, error) { return parseClusterStatus(reply) },
+	"ofproto/list":     func(reply string) (any, error) { return parseOfprotoList(reply), nil },
+	"upcall/show":      func(reply string) (any, error) { return parseUpcallShow(reply) },
+}
+
+// ParseReply parses the text reply of command into the same type as its
+// typed wrapper, ok is false for commands without one.
+func ParseReply(command, reply string) (result any, ok bool, err error) {
+	parse, ok := replyParsers[command]
+	if !ok {
+		return nil, false, nil
+	}
+
+	result, err = parse(reply)
+	return result, true, err
+}
@@ -0,0 +1,320 @@
+package appctl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/cenkalti/rpc2"
+	"github.com/cenkalti/rpc2/jsonrpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	version, err := parseVersion("ovs-vswitchd (Open vSwitch) 3.1.0\nDPDK 22.11.1\n")
+	require.NoError(t, err)
+
+	assert.Equal(t, &Version{
+		Program:   "ovs-vswitchd",
+		Package:   "Open vSwitch",
+		Version:   "3.1.0",
+		Libraries: map[string]string{"DPDK": "22.11.1"},
+	}, version)
+
+	_, err = parseVersion("")
+	assert.Error(t, err)
+}
+
+func TestParseListCommands(t *testing.T) {
+	commands := parseListCommands("The available commands are:\n  exit                    [--cleanup]\n  version\n")
+
+	assert.Equal(t, []Command{
+		{Name: "exit", Usage: "[--cleanup]"},
+		{Name: "version", Usage: ""},
+	}, commands)
+}
+
+func TestParseVlogList(t *testing.T) {
+	reply := `                 console    syslog    file
+                 -------    ------    ------
+backtrace          OFF       ERR       INFO
+dpif               OFF       ERR       DBG
+`
+
+	modules, err := parseVlogList(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, []VlogModule{
+		{Name: "backtrace", Levels: map[string]string{"console": "OFF", "syslog": "ERR", "file": "INFO"}},
+		{Name: "dpif", Levels: map[string]string{"console": "OFF", "syslog": "ERR", "file": "DBG"}},
+	}, modules)
+}
+
+func TestParseMemoryShow(t *testing.T) {
+	usage, err := parseMemoryShow("handlers:4 idl-cells:1124 ports:6 revalidators:2 rules:18 udpif keys:10\n")
+	require.NoError(t, err)
+
+	assert.Equal(t, MemoryUsage{
+		"handlers":     4,
+		"idl-cells":    1124,
+		"ports":        6,
+		"revalidators": 2,
+		"rules":        18,
+		"udpif keys":   10,
+	}, usage)
+}
+
+func TestParseCoverageShow(t *testing.T) {
+	reply := `Event coverage, avg rate over last: 5 seconds, last minute, last hour,  hash=2d2b1a6f:
+bridge_reconfigure         0.0/sec     0.000/sec        0.0003/sec   total: 3
+ofproto_flush              0.2/sec     0.017/sec        0.0050/sec   total: 18
+120 events never hit
+`
+
+	coverage, err := parseCoverageShow(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, &Coverage{
+		Hash: "2d2b1a6f",
+		Counters: []CoverageCounter{
+			{Name: "bridge_reconfigure", Rate5s: 0, RateMinute: 0, RateHour: 0.0003, Total: 3},
+			{Name: "ofproto_flush", Rate5s: 0.2, RateMinute: 0.017, RateHour: 0.005, Total: 18},
+		},
+		NeverHit: 120,
+	}, coverage)
+}
+
+func TestParseDpifShow(t *testing.T) {
+	reply := `system@ovs-system: hit:1250 missed:87
+  br-int:
+    br-int 65534/1: (internal)
+    patch-tun 1/none: (patch: peer=patch-int)
+`
+
+	datapaths, err := parseDpifShow(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Datapath{
+		{
+			Name:   "system@ovs-system",
+			Hit:    1250,
+			Missed: 87,
+			Bridges: []DpifBridge{
+				{
+					Name: "br-int",
+					Ports: []DpifPort{
+						{Name: "br-int", OFPort: "65534", DPPort: "1", Type: "internal", Options: map[string]string{}},
+						{Name: "patch-tun", OFPort: "1", DPPort: "none", Type: "patch", Options: map[string]string{"peer": "patch-int"}},
+					},
+				},
+			},
+		},
+	}, datapaths)
+
+	_, err = parseDpifShow("  br-int:\n")
+	assert.Error(t, err)
+}
+
+func TestParseDpctlDumpFlows(t *testing.T) {
+	reply := `ufid:1b2c3d4e-0000-0000-0000-000000000000, recirc_id(0),in_port(2),eth_type(0x0800), packets:10, bytes:980, used:0.512s, flags:S, actions:push_vlan(vid=10),3
+recirc_id(0),in_port(1), packets:0, bytes:0, used:never, actions:drop
+`
+
+	flows, err := parseDpctlDumpFlows(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, []DatapathFlow{
+		{
+			UFID:    "1b2c3d4e-0000-0000-0000-000000000000",
+			Match:   "recirc_id(0),in_port(2),eth_type(0x0800)",
+			Packets: 10,
+			Bytes:   980,
+			Used:    "0.512s",
+			Flags:   "S",
+			Actions: "push_vlan(vid=10),3",
+		},
+		{
+			Match:   "recirc_id(0),in_port(1)",
+			Used:    "never",
+			Actions: "drop",
+		},
+	}, flows)
+}
+
+func TestParseDpctlDumpFlowsDPDK(t *testing.T) {
+	reply := `flow-dump from pmd on cpu core: 2
+ufid:3a5d2b1c-6e7f-4a8b-9c0d-1e2f3a4b5c6d, recirc_id(0),in_port(dpdk0),packet_type(ns=0,id=0),eth(src=52:54:00:12:34:56,dst=fa:16:3e:aa:bb:cc),eth_type(0x0800),ipv4(frag=no), packets:1523, bytes:149254, used:0.004s, flags:P., dp:ovs, actions:vhu1a2b3c4d-5e, dp-extra-info:miniflow_bits(5,1)
+flow-dump from pmd on cpu core: 18
+recirc_id(0),in_port(vhu1a2b3c4d-5e),packet_type(ns=0,id=0),eth_type(0x0806), packets:2, bytes:84, used:3.120s, actions:dpdk0
+flow-dump from the main thread:
+recirc_id(0),in_port(br-int),packet_type(ns=0,id=0),eth_type(0x86dd), packets:0, bytes:0, used:never, actions:drop
+`
+
+	flows, err := parseDpctlDumpFlows(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, []DatapathFlow{
+		{
+			UFID:    "3a5d2b1c-6e7f-4a8b-9c0d-1e2f3a4b5c6d",
+			Match:   "recirc_id(0),in_port(dpdk0),packet_type(ns=0,id=0),eth(src=52:54:00:12:34:56,dst=fa:16:3e:aa:bb:cc),eth_type(0x0800),ipv4(frag=no)",
+			Packets: 1523,
+			Bytes:   149254,
+			Used:    "0.004s",
+			Flags:   "P.",
+			Actions: "vhu1a2b3c4d-5e",
+		},
+		{
+			Match:   "recirc_id(0),in_port(vhu1a2b3c4d-5e),packet_type(ns=0,id=0),eth_type(0x0806)",
+			Packets: 2,
+			Bytes:   84,
+			Used:    "3.120s",
+			Actions: "dpdk0",
+		},
+		{
+			Match:   "recirc_id(0),in_port(br-int),packet_type(ns=0,id=0),eth_type(0x86dd)",
+			Used:    "never",
+			Actions: "drop",
+		},
+	}, flows)
+}
+
+func TestParseRouteShow(t *testing.T) {
+	reply := `Route Table:
+Cached: 127.0.0.1/32 dev lo SRC 127.0.0.1 local
+Cached: 10.0.0.0/24 dev eth0 SRC 10.0.0.5
+User: 192.168.0.0/16 dev eth0 GW 10.0.0.1 SRC 10.0.0.5
+`
+
+	routes, err := parseRouteShow(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Route{
+		{Type: "Cached", Prefix: "127.0.0.1/32", Dev: "lo", Source: "127.0.0.1", Local: true},
+		{Type: "Cached", Prefix: "10.0.0.0/24", Dev: "eth0", Source: "10.0.0.5"},
+		{Type: "User", Prefix: "192.168.0.0/16", Dev: "eth0", Gateway: "10.0.0.1", Source: "10.0.0.5"},
+	}, routes)
+}
+
+func TestParseClusterStatus(t *testing.T) {
+	reply := `8e1f
+Name: OVN_Northbound
+Cluster ID: 5f3a (5f3a9c1e-1111-2222-3333-444455556666)
+Server ID: 8e1f (8e1f7b2d-aaaa-bbbb-cccc-ddddeeeeffff)
+Address: tcp:10.0.0.1:6643
+Status: cluster member
+Role: leader
+Term: 4
+Leader: self
+Vote: self
+
+Servers:
+    8e1f (8e1f at tcp:10.0.0.1:6643) (self) next_index=10 match_index=9
+    a2c4 (a2c4 at tcp:10.0.0.2:6643) next_index=10 match_index=9
+`
+
+	status, err := parseClusterStatus(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, &ClusterStatus{
+		Name:      "OVN_Northbound",
+		ClusterID: "5f3a9c1e-1111-2222-3333-444455556666",
+		ServerID:  "8e1f7b2d-aaaa-bbbb-cccc-ddddeeeeffff",
+		Address:   "tcp:10.0.0.1:6643",
+		Status:    "cluster member",
+		Role:      "leader",
+		Term:      4,
+		Leader:    "self",
+		Vote:      "self",
+		Servers: []ClusterServer{
+			{SID: "8e1f", Address: "tcp:10.0.0.1:6643", Self: true},
+			{SID: "a2c4", Address: "tcp:10.0.0.2:6643"},
+		},
+	}, status)
+
+	_, err = parseClusterStatus("unknown cluster\n")
+	assert.Error(t, err)
+}
+
+func TestParseUpcallShow(t *testing.T) {
+	reply := `system@ovs-system:
+  flows         : (current 12) (avg 10) (max 40) (limit 200000)
+  offloaded flows : 0
+  dump duration : 1ms
+  ufid enabled : true
+
+  4: (keys 6)
+  5: (keys 6)
+`
+
+	datapaths, err := parseUpcallShow(reply)
+	require.NoError(t, err)
+
+	assert.Equal(t, []UpcallDatapath{
+		{
+			Name:           "system@ovs-system",
+			Flows:          UpcallFlows{Current: 12, Avg: 10, Max: 40, Limit: 200000},
+			DumpDurationMs: 1,
+			UFIDEnabled:    true,
+			Revalidators:   map[int]uint64{4: 6, 5: 6},
+		},
+	}, datapaths)
+}
+
+func serveCommands(t *testing.T, handlers map[string]func(args []string) (string, error)) *Client {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+
+	server := rpc2.NewClientWithCodec(jsonrpc.NewJSONCodec(serverConn))
+	for command, handler := range handlers {
+		server.Handle(command, func(_ *rpc2.Client, args []string, reply *string) error {
+			result, err := handler(args)
+			*reply = result
+			return err
+		})
+	}
+	go server.Run()
+
+	client := NewClient(clientConn)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	return client
+}
+
+func TestRun(t *testing.T) {
+	client := serveCommands(t, map[string]func(args []string) (string, error){
+		"echo": func(args []string) (string, error) {
+			return strings.Join(args, " "), nil
+		},
+		"fail": func(args []string) (string, error) {
+			return "", errors.New("no such bridge\n")
+		},
+	})
+
+	reply, err := client.Run(context.Background(), "echo", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "a b", reply)
+
+	_, err = client.Run(context.Background(), "fail")
+
+	var commandErr *CommandError
+	require.ErrorAs(t, err, &commandErr)
+	assert.Equal(t, &CommandError{Command: "fail", Message: "no such bridge"}, commandErr)
+}
+
+func TestParseReply(t *testing.T) {
+	result, ok, err := ParseReply("ofproto/list", "br-int\nbr-ex\n")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"br-int", "br-ex"}, result)
+
+	_, ok, err = ParseReply("fdb/show", "")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,238 @@
+package appctl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	PROC_DIR = "/proc"
+
+	// COMM_LEN is the length the kernel truncates process names to
+	COMM_LEN = 15
+)
+
+var (
+	ErrStalePidFile = errors.New("pid file is stale")
+	ErrUnreachable  = errors.New("process is alive but unreachable")
+	ErrRunning      = errors.New("process is still running")
+
+	// ErrPidNamespace is returned when the pid file does not match a
+	// running process but a control socket answers, which happens when the
+	// daemon runs in another pid namespace
+	ErrPidNamespace = errors.New("process is running in another pid namespace")
+)
+
+// SOCKET_PROBE_TIMEOUT is how long to wait for a control socket to accept a
+// connection when checking whether a daemon is still alive
+const SOCKET_PROBE_TIMEOUT = time.Second
+
+// Process is a running daemon, referenced by a pidfd when the kernel
+// supports it so that it cannot be confused with a reused PID.
+type Process struct {
+	Pid   int
+	pidfd int
+
+	// StartTime is the start time of the process in clock ticks since boot,
+	// which tells it apart from a reused PID when pidfds are not supported
+	StartTime uint64
+}
+
+// Fd returns the pidfd of the process, -1 if pidfds are not supported.
+func (p *Process) Fd() int {
+	return p.pidfd
+}
+
+// Alive returns whether the process is still running
+func (p *Process) Alive() bool {
+	if p.pidfd >= 0 {
+		return unix.PidfdSendSignal(p.pidfd, 0, nil, 0) == nil
+	}
+
+	err := unix.Kill(p.Pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
+
+func (p *Process) Close() error {
+	if p.pidfd < 0 {
+		return nil
+	}
+
+	err := unix.Close(p.pidfd)
+	p.pidfd = -1
+	return err
+}
+
+func readPidFile(runDir, name string) (int, error) {
+	path := PidFile(runDir, name)
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrNoPidFile
+		}
+		return 0, fmt.Errorf("failed to read pid file %s: %w", path, err)
+	}
+
+	var pid int
+	_, err = fmt.Sscanf(string(bytes), "%d", &pid)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("%w: failed to parse pid from %s", ErrStalePidFile, path)
+	}
+
+	return pid, nil
+}
+
+// processName returns the name of the binary running as pid, falling back
+// to its truncated comm when the exe link cannot be read.
+func processName(procDir string, pid int) (string, error) {
+	exe, err := os.Readlink(fmt.Sprintf("%s/%d/exe", procDir, pid))
+	if err == nil {
+		return filepath.Base(strings.TrimSuffix(exe, " (deleted)")), nil
+	}
+	if os.IsNotExist(err) {
+		return "", err
+	}
+
+	comm, err := os.ReadFile(fmt.Sprintf("%s/%d/comm", procDir, pid))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(comm), "\n"), nil
+}
+
+// startTime returns the start time of pid in clock ticks since boot
+func startTime(procDir string, pid int) (uint64, error) {
+	fs, err := procfs.NewFS(procDir)
+	if err != nil {
+		return 0, err
+	}
+
+	proc, err := fs.Proc(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	stat, err := proc.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return stat.Starttime, nil
+}
+
+// isBinary returns whether name matches binary, accounting for comm being
+// truncated.
+func isBinary(name, binary string) bool {
+	if name == binary {
+		return true
+	}
+
+	return len(name) == COMM_LEN && strings.HasPrefix(binary, name)
+}
+
+func findProcess(runDir, procDir, binary string) (*Process, error) {
+	return findDaemon(runDir, procDir, binary, binary)
+}
+
+// answeringSocket returns the control socket of name which accepts
+// connections, if any
+func answeringSocket(runDir, name string) (string, bool) {
+	matches, err := filepath.Glob(SocketPattern(runDir, name))
+	if err != nil {
+		return "", false
+	}
+
+	for _, path := range append(matches, FixedSocket(runDir, name)) {
+		conn, err := net.DialTimeout("unix", path, SOCKET_PROBE_TIMEOUT)
+		if err == nil {
+			_ = conn.Close()
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// findDaemon returns the process of binary according to the pid file named
+// after name, which differs from binary for daemons such as the OVN
+// databases which run as ovsdb-server.  A pid file which does not match a
+// running process is only stale if no control socket answers either, since
+// the pid of a daemon in another pid namespace means nothing here.
+func findDaemon(runDir, procDir, name, binary string) (*Process, error) {
+	process, err := findPidFileProcess(runDir, procDir, name, binary)
+	if errors.Is(err, ErrStalePidFile) {
+		if path, ok := answeringSocket(runDir, name); ok {
+			return nil, fmt.Errorf("%w: %s answers on %s although %v", ErrPidNamespace, name, path, err)
+		}
+	}
+
+	return process, err
+}
+
+func findPidFileProcess(runDir, procDir, name, binary string) (*Process, error) {
+	pid, err := readPidFile(runDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the pidfd before checking the binary, so the check applies to
+	// the process the pidfd refers to
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	switch {
+	case errors.Is(err, unix.ESRCH):
+		return nil, fmt.Errorf("%w: %s (pid %d) is not running", ErrStalePidFile, binary, pid)
+	case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EPERM):
+		pidfd = -1
+	case err != nil:
+		return nil, fmt.Errorf("failed to open pidfd for pid %d: %w", pid, err)
+	}
+
+	process := &Process{Pid: pid, pidfd: pidfd}
+
+	if pidfd < 0 {
+		process.StartTime, err = startTime(procDir, pid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%w: %s (pid %d) is not running", ErrStalePidFile, binary, pid)
+			}
+			return nil, fmt.Errorf("failed to read start time of pid %d: %w", pid, err)
+		}
+	}
+
+	running, err := processName(procDir, pid)
+	if err != nil {
+		_ = process.Close()
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s (pid %d) is not running", ErrStalePidFile, binary, pid)
+		}
+		return nil, fmt.Errorf("failed to identify pid %d: %w", pid, err)
+	}
+
+	if !isBinary(running, binary) {
+		_ = process.Close()
+		return nil, fmt.Errorf("%w: pid %d belongs to %s instead of %s", ErrStalePidFile, pid, running, binary)
+	}
+
+	if !process.Alive() {
+		_ = process.Close()
+		return nil, fmt.Errorf("%w: %s (pid %d) is not running", ErrStalePidFile, binary, pid)
+	}
+
+	return process, nil
+}
+
+// FindProcess returns the running process of binary according to its pid
+// file, failing with ErrNoPidFile when it is not running and ErrStalePidFile
+// when the pid file belongs to a dead process.
+func FindProcess(runDir, binary string) (*Process, error) {
+	return findProcess(runDir, PROC_DIR, binary)
+}
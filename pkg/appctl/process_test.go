@@ -0,0 +1,288 @@
+package appctl
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func selfBinary(t *testing.T) string {
+	t.Helper()
+
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	return filepath.Base(exe)
+}
+
+func writePidFile(t *testing.T, dir, binary, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, fmt.Sprintf("%s.pid", binary))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestFindProcess(t *testing.T) {
+	dir := t.TempDir()
+	binary := selfBinary(t)
+
+	writePidFile(t, dir, binary, fmt.Sprintf("%d\n", os.Getpid()))
+
+	process, err := findProcess(dir, PROC_DIR, binary)
+	require.NoError(t, err)
+	defer func() {
+		if err := process.Close(); err != nil {
+			t.Errorf("failed to close process: %v", err)
+		}
+	}()
+
+	assert.Equal(t, os.Getpid(), process.Pid)
+	assert.True(t, process.Alive())
+}
+
+func TestFindProcessNoPidFile(t *testing.T) {
+	_, err := findProcess(t.TempDir(), PROC_DIR, "ovs-vswitchd")
+	assert.ErrorIs(t, err, ErrNoPidFile)
+}
+
+func TestFindProcessStale(t *testing.T) {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+
+	tests := []struct {
+		name    string
+		binary  string
+		content string
+	}{
+		{"not running", "ovs-vswitchd", fmt.Sprintf("%d\n", cmd.Process.Pid)},
+		{"reused pid", "ovs-vswitchd", fmt.Sprintf("%d\n", os.Getpid())},
+		{"invalid pid", "ovs-vswitchd", "garbage\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePidFile(t, dir, tt.binary, tt.content)
+
+			_, err := findProcess(dir, PROC_DIR, tt.binary)
+			assert.ErrorIs(t, err, ErrStalePidFile)
+		})
+	}
+}
+
+func TestFindProcessComm(t *testing.T) {
+	tests := []struct {
+		binary string
+		comm   string
+	}{
+		{"ovs-vswitchd", "ovs-vswitchd"},
+		{"ovn-controller-vtep", "ovn-controller-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.binary, func(t *testing.T) {
+			dir := t.TempDir()
+			writePidFile(t, dir, tt.binary, fmt.Sprintf("%d\n", os.Getpid()))
+
+			// Without access to the exe link, the binary is identified by
+			// its comm
+			procDir := t.TempDir()
+			pidDir := filepath.Join(procDir, fmt.Sprint(os.Getpid()))
+			require.NoError(t, os.Mkdir(pidDir, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(pidDir, "exe"), nil, 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(pidDir, "comm"), []byte(tt.comm+"\n"), 0o644))
+
+			process, err := findProcess(dir, procDir, tt.binary)
+			require.NoError(t, err)
+			assert.NoError(t, process.Close())
+		})
+	}
+}
+
+func TestDialBinary(t *testing.T) {
+	dir := t.TempDir()
+	binary := selfBinary(t)
+
+	writePidFile(t, dir, binary, fmt.Sprintf("%d\n", os.Getpid()))
+
+	_, err := dialBinary(dir, PROC_DIR, binary)
+	assert.ErrorIs(t, err, ErrUnreachable)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, fmt.Sprintf("%s.%d.ctl", binary, os.Getpid())))
+	require.NoError(t, err)
+	defer func() {
+		if err := listener.Close(); err != nil {
+			t.Errorf("failed to close listener: %v", err)
+		}
+	}()
+
+	client, err := dialBinary(dir, PROC_DIR, binary)
+	require.NoError(t, err)
+	require.NotNil(t, client.Process)
+	assert.Equal(t, os.Getpid(), client.Process.Pid)
+	assert.NoError(t, client.Close())
+}
+
+func TestCleanup(t *testing.T) {
+	binary := selfBinary(t)
+
+	t.Run("running", func(t *testing.T) {
+		dir := t.TempDir()
+		writePidFile(t, dir, binary, fmt.Sprintf("%d\n", os.Getpid()))
+
+		err := cleanup(dir, PROC_DIR, binary)
+		assert.ErrorIs(t, err, ErrRunning)
+		assert.FileExists(t, filepath.Join(dir, binary+".pid"))
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		cmd := exec.Command("true")
+		require.NoError(t, cmd.Run())
+
+		dir := t.TempDir()
+		writePidFile(t, dir, binary, fmt.Sprintf("%d\n", cmd.Process.Pid))
+		socketPath := filepath.Join(dir, fmt.Sprintf("%s.%d.ctl", binary, cmd.Process.Pid))
+		require.NoError(t, os.WriteFile(socketPath, nil, 0o644))
+
+		require.NoError(t, cleanup(dir, PROC_DIR, binary))
+		assert.NoFileExists(t, filepath.Join(dir, binary+".pid"))
+		assert.NoFileExists(t, socketPath)
+	})
+}
+
+func TestRunDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		binary string
+		env    map[string]string
+		want   string
+	}{
+		{name: "ovs", binary: "ovs-vswitchd", want: RUN_DIR},
+		{name: "ovn", binary: "ovn-controller", want: OVN_RUN_DIR},
+		{name: "ovs env", binary: "ovsdb-server", env: map[string]string{"OVS_RUNDIR": "/var/run/ovs"}, want: "/var/run/ovs"},
+		{name: "ovn env", binary: "ovn-northd", env: map[string]string{"OVS_RUNDIR": "/var/run/ovs", "OVN_RUNDIR": "/var/run/ovn"}, want: "/var/run/ovn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OVS_RUNDIR", "")
+			t.Setenv("OVN_RUNDIR", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			assert.Equal(t, tt.want, RunDir(tt.binary))
+		})
+	}
+}
+
+func TestDialDaemonFixedSocket(t *testing.T) {
+	dir := t.TempDir()
+	binary := selfBinary(t)
+
+	writePidFile(t, dir, "ovnnb_db", fmt.Sprintf("%d\n", os.Getpid()))
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "ovnnb_db.ctl"))
+	require.NoError(t, err)
+	defer func() {
+		if err := listener.Close(); err != nil {
+			t.Errorf("failed to close listener: %v", err)
+		}
+	}()
+
+	client, err := dialDaemon(dir, PROC_DIR, "ovnnb_db", binary)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), client.Process.Pid)
+	assert.NoError(t, client.Close())
+
+	// The pid belongs to another binary, but the socket answers
+	_, err = dialDaemon(dir, PROC_DIR, "ovnnb_db", "ovsdb-server")
+	assert.ErrorIs(t, err, ErrPidNamespace)
+}
+
+func TestPidNamespace(t *testing.T) {
+	dir := t.TempDir()
+
+	// Without a shared pid namespace, the pid of the daemon is often the one
+	// of ovsinit itself
+	writePidFile(t, dir, "ovs-vswitchd", fmt.Sprintf("%d\n", os.Getpid()))
+	socketPath := filepath.Join(dir, "ovs-vswitchd.1.ctl")
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	_, err = dialDaemon(dir, PROC_DIR, "ovs-vswitchd", "ovs-vswitchd")
+	assert.ErrorIs(t, err, ErrPidNamespace)
+	assert.NotErrorIs(t, err, ErrStalePidFile)
+
+	// Commands can still be sent to the socket which answers
+	client, err := DialSocket(dir, "ovs-vswitchd")
+	require.NoError(t, err)
+	assert.Nil(t, client.Process)
+	assert.NoError(t, client.Close())
+
+	err = cleanup(dir, PROC_DIR, "ovs-vswitchd")
+	assert.ErrorIs(t, err, ErrRunning)
+	assert.FileExists(t, filepath.Join(dir, "ovs-vswitchd.pid"))
+
+	// Once nothing answers, the files are stale
+	require.NoError(t, listener.Close())
+	require.NoError(t, os.WriteFile(socketPath, nil, 0o644))
+
+	_, err = dialDaemon(dir, PROC_DIR, "ovs-vswitchd", "ovs-vswitchd")
+	assert.ErrorIs(t, err, ErrStalePidFile)
+	_, err = DialSocket(dir, "ovs-vswitchd")
+	assert.ErrorIs(t, err, ErrUnreachable)
+	require.NoError(t, cleanup(dir, PROC_DIR, "ovs-vswitchd"))
+	assert.NoFileExists(t, filepath.Join(dir, "ovs-vswitchd.pid"))
+}
+
+func TestDialSocketPidFile(t *testing.T) {
+	dir := t.TempDir()
+
+	writePidFile(t, dir, "ovs-vswitchd", "42\n")
+
+	// A socket left behind by an earlier daemon answers too
+	stale, err := net.Listen("unix", filepath.Join(dir, "ovs-vswitchd.1.ctl"))
+	require.NoError(t, err)
+	defer func() {
+		if err := stale.Close(); err != nil {
+			t.Errorf("failed to close listener: %v", err)
+		}
+	}()
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "ovs-vswitchd.42.ctl"))
+	require.NoError(t, err)
+	defer func() {
+		if err := listener.Close(); err != nil {
+			t.Errorf("failed to close listener: %v", err)
+		}
+	}()
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			err = conn.Close()
+		}
+		accepted <- err
+	}()
+
+	client, err := DialSocket(dir, "ovs-vswitchd")
+	require.NoError(t, err)
+	assert.NoError(t, client.Close())
+
+	select {
+	case err := <-accepted:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the socket named after the pid file was not dialed")
+	}
+}
@@ -0,0 +1,180 @@
+// Package compat decides whether a running daemon may be replaced by the
+// version of the incoming binary, before anything is stopped.
+package compat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAJOR_ALLOW              = "allow"
+	MAJOR_BLOCK              = "block"
+	MAJOR_REQUIRE_CONVERSION = "require-conversion"
+)
+
+// ErrIncompatible is returned when the policy forbids the handoff
+var ErrIncompatible = errors.New("incompatible versions")
+
+// Upgrade is an upgrade path between two versions, given as prefixes of
+// their components such as 3.3 for any 3.3.x release
+type Upgrade struct {
+	From string
+	To   string
+}
+
+// ParseUpgrade parses an upgrade path given as from:to
+func ParseUpgrade(value string) (Upgrade, error) {
+	from, to, ok := strings.Cut(value, ":")
+	if !ok || from == "" || to == "" {
+		return Upgrade{}, fmt.Errorf("invalid upgrade path %q, must be from:to", value)
+	}
+
+	return Upgrade{From: from, To: to}, nil
+}
+
+func (u Upgrade) String() string {
+	return u.From + ":" + u.To
+}
+
+// Policy describes which handoffs between versions are safe, the zero value
+// allows all of them
+type Policy struct {
+	// BlockDowngrades refuses replacing a daemon with an older version
+	BlockDowngrades bool
+
+	// MajorUpgrades is one of MAJOR_ALLOW, MAJOR_BLOCK or
+	// MAJOR_REQUIRE_CONVERSION, which only allows them when the database
+	// is converted to the schema of the new version.  Empty allows them.
+	MajorUpgrades string
+
+	// AllowedUpgrades restricts upgrades to these paths, any upgrade is
+	// allowed when empty
+	AllowedUpgrades []Upgrade
+}
+
+// IsZero returns whether the policy allows every handoff
+func (p Policy) IsZero() bool {
+	return !p.BlockDowngrades && (p.MajorUpgrades == "" || p.MajorUpgrades == MAJOR_ALLOW) && len(p.AllowedUpgrades) == 0
+}
+
+// Check returns an error wrapping ErrIncompatible when replacing the running
+// version with the incoming one is unsafe, converting being whether the
+// database is converted along.  Unless the policy allows every handoff,
+// versions which are unknown or cannot be parsed are refused since nothing
+// can be said about them.
+func (p Policy) Check(running, incoming string, converting bool) error {
+	if p.IsZero() {
+		return nil
+	}
+
+	from, err := parse(running)
+	if err != nil {
+		return fmt.Errorf("%w: running %w", ErrIncompatible, err)
+	}
+
+	to, err := parse(incoming)
+	if err != nil {
+		return fmt.Errorf("%w: incoming %w", ErrIncompatible, err)
+	}
+
+	switch compare(from, to) {
+	case 0:
+		return nil
+	case 1:
+		if p.BlockDowngrades {
+			return fmt.Errorf("%w: downgrade from %s to %s is blocked", ErrIncompatible, running, incoming)
+		}
+		return nil
+	}
+
+	if from[0] != to[0] {
+		switch p.MajorUpgrades {
+		case MAJOR_BLOCK:
+			return fmt.Errorf("%w: major upgrade from %s to %s is blocked", ErrIncompatible, running, incoming)
+		case MAJOR_REQUIRE_CONVERSION:
+			if !converting {
+				return fmt.Errorf("%w: major upgrade from %s to %s requires converting the database", ErrIncompatible, running, incoming)
+			}
+		}
+	}
+
+	if len(p.AllowedUpgrades) == 0 {
+		return nil
+	}
+
+	for _, upgrade := range p.AllowedUpgrades {
+		if matches(upgrade.From, from) && matches(upgrade.To, to) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: upgrade from %s to %s is not an allowed upgrade path", ErrIncompatible, running, incoming)
+}
+
+// parse returns the numeric components of version, ignoring any suffix
+// such as a distribution release
+func parse(version string) ([]int, error) {
+	var components []int
+	for _, part := range strings.Split(version, ".") {
+		digits := part
+		if i := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			digits = part[:i]
+		}
+
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			break
+		}
+		components = append(components, n)
+
+		if len(digits) < len(part) {
+			break
+		}
+	}
+
+	if len(components) == 0 {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+
+	return components, nil
+}
+
+func compare(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var numA, numB int
+		if i < len(a) {
+			numA = a[i]
+		}
+		if i < len(b) {
+			numB = b[i]
+		}
+
+		switch {
+		case numA < numB:
+			return -1
+		case numA > numB:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// matches returns whether the components of prefix start version
+func matches(prefix string, version []int) bool {
+	components, err := parse(prefix)
+	if err != nil || len(components) > len(version) {
+		return false
+	}
+
+	for i, n := range components {
+		if version[i] != n {
+			return false
+		}
+	}
+
+	return true
+}
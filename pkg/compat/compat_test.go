@@ -0,0 +1,134 @@
+package compat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []int
+		wantErr bool
+	}{
+		{version: "3.4.1", want: []int{3, 4, 1}},
+		{version: "24.03.2", want: []int{24, 3, 2}},
+		{version: "3.3.0-1.el9", want: []int{3, 3, 0}},
+		{version: "3.5", want: []int{3, 5}},
+		{version: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := parse(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     Policy
+		running    string
+		incoming   string
+		converting bool
+		wantErr    bool
+	}{
+		{
+			name:     "same version",
+			policy:   Policy{BlockDowngrades: true, MajorUpgrades: MAJOR_BLOCK},
+			running:  "3.4.1",
+			incoming: "3.4.1",
+		},
+		{
+			name:     "downgrade allowed by default",
+			running:  "3.5.0",
+			incoming: "3.4.1",
+		},
+		{
+			name:     "downgrade blocked",
+			policy:   Policy{BlockDowngrades: true},
+			running:  "3.5.0",
+			incoming: "3.4.1",
+			wantErr:  true,
+		},
+		{
+			name:     "major upgrade blocked",
+			policy:   Policy{MajorUpgrades: MAJOR_BLOCK},
+			running:  "2.17.9",
+			incoming: "3.0.0",
+			wantErr:  true,
+		},
+		{
+			name:     "major upgrade without conversion",
+			policy:   Policy{MajorUpgrades: MAJOR_REQUIRE_CONVERSION},
+			running:  "2.17.9",
+			incoming: "3.0.0",
+			wantErr:  true,
+		},
+		{
+			name:       "major upgrade with conversion",
+			policy:     Policy{MajorUpgrades: MAJOR_REQUIRE_CONVERSION},
+			running:    "2.17.9",
+			incoming:   "3.0.0",
+			converting: true,
+		},
+		{
+			name:     "minor upgrade with major upgrades blocked",
+			policy:   Policy{MajorUpgrades: MAJOR_BLOCK},
+			running:  "3.3.0",
+			incoming: "3.5.0",
+		},
+		{
+			name:     "allowed upgrade path",
+			policy:   Policy{AllowedUpgrades: []Upgrade{{From: "3.3", To: "3.4"}, {From: "3.4", To: "3.5"}}},
+			running:  "3.4.1",
+			incoming: "3.5.0",
+		},
+		{
+			name:     "upgrade path not allowed",
+			policy:   Policy{AllowedUpgrades: []Upgrade{{From: "3.3", To: "3.4"}, {From: "3.4", To: "3.5"}}},
+			running:  "3.3.2",
+			incoming: "3.5.0",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.running, tt.incoming, tt.converting)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrIncompatible)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// Without a policy there is nothing to check
+	assert.NoError(t, Policy{}.Check("unknown", "", false))
+
+	// With one, unknown versions are refused
+	policy := Policy{BlockDowngrades: true}
+	assert.ErrorIs(t, policy.Check("unknown", "3.5.0", false), ErrIncompatible)
+	assert.ErrorIs(t, policy.Check("3.4.1", "", false), ErrIncompatible)
+}
+
+func TestParseUpgrade(t *testing.T) {
+	upgrade, err := ParseUpgrade("24.03:24.09")
+	require.NoError(t, err)
+	assert.Equal(t, Upgrade{From: "24.03", To: "24.09"}, upgrade)
+	assert.Equal(t, "24.03:24.09", upgrade.String())
+
+	_, err = ParseUpgrade("24.03")
+	assert.Error(t, err)
+}
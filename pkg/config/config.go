@@ -0,0 +1,313 @@
+// Package config loads the declarative configuration of ovsinit, which is
+// meant to be mounted from a ConfigMap and provides the defaults of its
+// flags.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Duration is a time.Duration written as a string such as "30s"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+// Config is the configuration of ovsinit, unset fields keep the defaults of
+// the matching flags.
+type Config struct {
+	Profile    string     `json:"profile,omitempty"`
+	RunDir     string     `json:"runDir,omitempty"`
+	Timeouts   Timeouts   `json:"timeouts,omitempty"`
+	Verifiers  Verifiers  `json:"verifiers,omitempty"`
+	Database   Database   `json:"database,omitempty"`
+	Succession Succession `json:"succession,omitempty"`
+	Metrics    Metrics    `json:"metrics,omitempty"`
+	Log        Log        `json:"log,omitempty"`
+	Hooks      []Hook     `json:"hooks,omitempty"`
+
+	Compatibility Compatibility `json:"compatibility,omitempty"`
+
+	// Supervise keeps ovsinit running as the parent of the daemon instead
+	// of exec'ing it
+	Supervise *bool `json:"supervise,omitempty"`
+
+	// ReportFile is where to write the JSON report of the handoff, such as
+	// /dev/termination-log
+	ReportFile string `json:"reportFile,omitempty"`
+}
+
+type Timeouts struct {
+	// Dial is how long to retry connecting to a daemon which is running
+	// but unreachable
+	Dial *Duration `json:"dial,omitempty"`
+
+	// Verify is how long to wait for the verifiers after the daemon was
+	// asked to exit
+	Verify *Duration `json:"verify,omitempty"`
+
+	LeaveCluster *Duration `json:"leaveCluster,omitempty"`
+}
+
+type Verifiers struct {
+	// HugePages waits for the hugepages of the daemon to be released,
+	// defaulting to its profile
+	HugePages *bool `json:"hugePages,omitempty"`
+
+	// FileRemoval are glob patterns of files which must be removed once
+	// the daemon exited, in addition to its pid file and sockets
+	FileRemoval []string `json:"fileRemoval,omitempty"`
+}
+
+type Database struct {
+	Path          string          `json:"path,omitempty"`
+	Schema        string          `json:"schema,omitempty"`
+	Backups       *int            `json:"backups,omitempty"`
+	RestoreBackup *bool           `json:"restoreBackup,omitempty"`
+	Cluster       DatabaseCluster `json:"cluster,omitempty"`
+}
+
+type DatabaseCluster struct {
+	Local     string   `json:"local,omitempty"`
+	Remotes   []string `json:"remotes,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	// Leave is whether prestop leaves the cluster before stopping the
+	// daemon, when the member is removed
+	Leave *bool `json:"leave,omitempty"`
+
+	// TLS is used to connect to ssl: endpoints
+	TLS DatabaseTLS `json:"tls,omitempty"`
+}
+
+// DatabaseTLS are the PEM files to connect to ssl: endpoints, like the
+// --private-key, --certificate and --ca-cert options of the OVS tools
+type DatabaseTLS struct {
+	PrivateKey  string `json:"privateKey,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+	CACert      string `json:"caCert,omitempty"`
+}
+
+// IsZero returns whether no TLS file is configured
+func (t DatabaseTLS) IsZero() bool {
+	return t.PrivateKey == "" && t.Certificate == "" && t.CACert == ""
+}
+
+type Succession struct {
+	Backend    string    `json:"backend,omitempty"`
+	TTL        *Duration `json:"ttl,omitempty"`
+	MaxHistory *int      `json:"maxHistory,omitempty"`
+}
+
+type Metrics struct {
+	// Textfile is where to write the metrics of the handoff, for the
+	// textfile collector of node_exporter
+	Textfile string `json:"textfile,omitempty"`
+}
+
+type Log struct {
+	// Level is the minimum level of the logs: debug, info, warn or error
+	Level string `json:"level,omitempty"`
+	// Format is either text or json
+	Format string `json:"format,omitempty"`
+}
+
+// Hook is an action run at a phase of the handoff, given either as a
+// command or as a function registered in ovsinit
+type Hook struct {
+	// Name identifies the hook in logs and reports
+	Name string `json:"name,omitempty"`
+
+	// Phase is one of pre-claim, pre-exit, post-exit or pre-exec
+	Phase string `json:"phase"`
+
+	// Daemons are the names of the daemons the hook runs for, such as
+	// ovs-vswitchd or ovnnb_db, all when empty so that one file can be
+	// shared by several daemons
+	Daemons []string `json:"daemons,omitempty"`
+
+	Command []string `json:"command,omitempty"`
+	Func    string   `json:"func,omitempty"`
+	Args    []string `json:"args,omitempty"`
+
+	Timeout *Duration `json:"timeout,omitempty"`
+
+	// Policy is fail-closed to abort the handoff when the hook fails,
+	// which is the default, or fail-open to continue
+	Policy string `json:"policy,omitempty"`
+}
+
+// Compatibility is the policy deciding whether the versions of the existing
+// and new daemons are safe to hand off between
+type Compatibility struct {
+	BlockDowngrades *bool `json:"blockDowngrades,omitempty"`
+
+	// MajorUpgrades is allow, block or require-conversion
+	MajorUpgrades string `json:"majorUpgrades,omitempty"`
+
+	// AllowedUpgrades are the from:to version prefixes of the only
+	// upgrades allowed, such as 3.3:3.4
+	AllowedUpgrades []string `json:"allowedUpgrades,omitempty"`
+}
+
+// Load reads and validates the configuration at path, rejecting unknown
+// fields so that typos are not silently ignored.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// Validate checks the values of the configuration, reporting every invalid
+// field by its path.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	durations := []struct {
+		field    string
+		duration *Duration
+	}{
+		{"timeouts.dial", c.Timeouts.Dial},
+		{"timeouts.verify", c.Timeouts.Verify},
+		{"timeouts.leaveCluster", c.Timeouts.LeaveCluster},
+		{"succession.ttl", c.Succession.TTL},
+	}
+	for _, d := range durations {
+		if d.duration != nil && d.duration.Duration < 0 {
+			invalid(d.field, "must not be negative")
+		}
+	}
+
+	if c.Database.Backups != nil && *c.Database.Backups < 0 {
+		invalid("database.backups", "must not be negative")
+	}
+
+	if c.Database.Path == "" && (c.Database.Schema != "" || c.Database.Cluster.Local != "") {
+		invalid("database.path", "is required when the database is configured")
+	}
+
+	if c.Database.Cluster.Local == "" && len(c.Database.Cluster.Remotes) > 0 {
+		invalid("database.cluster.local", "is required to join remotes")
+	}
+
+	tlsConfig := c.Database.Cluster.TLS
+	if !tlsConfig.IsZero() && (tlsConfig.PrivateKey == "" || tlsConfig.Certificate == "" || tlsConfig.CACert == "") {
+		invalid("database.cluster.tls", "privateKey, certificate and caCert are all required")
+	}
+
+	for i, endpoint := range c.Database.Cluster.Endpoints {
+		if strings.HasPrefix(endpoint, "ssl:") && tlsConfig.IsZero() {
+			invalid(fmt.Sprintf("database.cluster.endpoints[%d]", i), "requires database.cluster.tls, got %q", endpoint)
+		}
+	}
+
+	switch c.Succession.Backend {
+	case "", "sqlite", "lease":
+	default:
+		invalid("succession.backend", "must be sqlite or lease, got %q", c.Succession.Backend)
+	}
+
+	if c.Succession.MaxHistory != nil && *c.Succession.MaxHistory < 1 {
+		invalid("succession.maxHistory", "must be at least 1")
+	}
+
+	if c.Log.Level != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+			invalid("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+		}
+	}
+
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		invalid("log.format", "must be text or json, got %q", c.Log.Format)
+	}
+
+	switch c.Compatibility.MajorUpgrades {
+	case "", "allow", "block", "require-conversion":
+	default:
+		invalid("compatibility.majorUpgrades", "must be allow, block or require-conversion, got %q", c.Compatibility.MajorUpgrades)
+	}
+
+	for i, upgrade := range c.Compatibility.AllowedUpgrades {
+		if from, to, ok := strings.Cut(upgrade, ":"); !ok || from == "" || to == "" {
+			invalid(fmt.Sprintf("compatibility.allowedUpgrades[%d]", i), "must be from:to, got %q", upgrade)
+		}
+	}
+
+	for i, hook := range c.Hooks {
+		field := fmt.Sprintf("hooks[%d]", i)
+
+		switch hook.Phase {
+		case "pre-claim", "pre-exit", "post-exit", "pre-exec":
+		default:
+			invalid(field+".phase", "must be pre-claim, pre-exit, post-exit or pre-exec, got %q", hook.Phase)
+		}
+
+		if (len(hook.Command) > 0) == (hook.Func != "") {
+			invalid(field, "exactly one of command or func is required")
+		}
+
+		if len(hook.Args) > 0 && hook.Func == "" {
+			invalid(field+".args", "is only supported with func")
+		}
+
+		if hook.Timeout != nil && hook.Timeout.Duration <= 0 {
+			invalid(field+".timeout", "must be positive")
+		}
+
+		switch hook.Policy {
+		case "", "fail-closed", "fail-open":
+		default:
+			invalid(field+".policy", "must be fail-closed or fail-open, got %q", hook.Policy)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ovsinit.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+profile: ovn-nb-db
+timeouts:
+  verify: 45s
+verifiers:
+  hugePages: false
+  fileRemoval:
+    - /run/ovn/ovnnb_db.sock
+database:
+  path: /etc/ovn/ovnnb_db.db
+  backups: 3
+  cluster:
+    local: tcp:10.0.0.1:6643
+    remotes: [tcp:10.0.0.2:6643]
+succession:
+  backend: lease
+  maxHistory: 10
+hooks:
+  - name: drain-bgp
+    phase: pre-exit
+    daemons: [ovn-controller]
+    command: [/usr/local/bin/drain-bgp]
+    timeout: 1m
+    policy: fail-open
+`), 0o644))
+
+	config, err := Load(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ovn-nb-db", config.Profile)
+	assert.Equal(t, 45*time.Second, config.Timeouts.Verify.Duration)
+	assert.Nil(t, config.Timeouts.Dial)
+	require.NotNil(t, config.Verifiers.HugePages)
+	assert.False(t, *config.Verifiers.HugePages)
+	assert.Equal(t, []string{"/run/ovn/ovnnb_db.sock"}, config.Verifiers.FileRemoval)
+	assert.Equal(t, 3, *config.Database.Backups)
+	assert.Equal(t, []string{"tcp:10.0.0.2:6643"}, config.Database.Cluster.Remotes)
+	assert.Equal(t, "lease", config.Succession.Backend)
+	assert.Equal(t, 10, *config.Succession.MaxHistory)
+	require.Len(t, config.Hooks, 1)
+	assert.Equal(t, "pre-exit", config.Hooks[0].Phase)
+	assert.Equal(t, []string{"/usr/local/bin/drain-bgp"}, config.Hooks[0].Command)
+	assert.Equal(t, time.Minute, config.Hooks[0].Timeout.Duration)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		errors []string
+	}{
+		{
+			name:   "unknown field",
+			config: "timeout:\n  verify: 30s\n",
+			errors: []string{`unknown field "timeout"`},
+		},
+		{
+			name:   "bad duration",
+			config: "timeouts:\n  verify: 30\n",
+			errors: []string{"duration must be a string"},
+		},
+		{
+			name:   "invalid values",
+			config: "timeouts:\n  dial: -1s\ndatabase:\n  schema: /usr/share/openvswitch/vswitch.ovsschema\nsuccession:\n  backend: etcd\n",
+			errors: []string{
+				"timeouts.dial: must not be negative",
+				"database.path: is required",
+				`succession.backend: must be sqlite or lease, got "etcd"`,
+			},
+		},
+		{
+			name:   "invalid tls",
+			config: "database:\n  path: /etc/ovn/ovnsb_db.db\n  cluster:\n    endpoints: [ssl:10.0.0.1:6642]\n",
+			errors: []string{
+				`database.cluster.endpoints[0]: requires database.cluster.tls, got "ssl:10.0.0.1:6642"`,
+			},
+		},
+		{
+			name:   "incomplete tls",
+			config: "database:\n  path: /etc/ovn/ovnsb_db.db\n  cluster:\n    tls:\n      privateKey: /etc/ovn/key.pem\n",
+			errors: []string{
+				"database.cluster.tls: privateKey, certificate and caCert are all required",
+			},
+		},
+		{
+			name:   "invalid log",
+			config: "log:\n  level: verbose\n  format: logfmt\n",
+			errors: []string{
+				`log.level: must be debug, info, warn or error, got "verbose"`,
+				`log.format: must be text or json, got "logfmt"`,
+			},
+		},
+		{
+			name:   "invalid compatibility",
+			config: "compatibility:\n  majorUpgrades: never\n  allowedUpgrades: [\"3.3\"]\n",
+			errors: []string{
+				`compatibility.majorUpgrades: must be allow, block or require-conversion, got "never"`,
+				`compatibility.allowedUpgrades[0]: must be from:to, got "3.3"`,
+			},
+		},
+		{
+			name:   "invalid hooks",
+			config: "hooks:\n- phase: post-exec\n  command: [true]\n  func: appctl\n  policy: ignore\n",
+			errors: []string{
+				`hooks[0].phase: must be pre-claim, pre-exit, post-exit or pre-exec, got "post-exec"`,
+				"hooks[0]: exactly one of command or func is required",
+				`hooks[0].policy: must be fail-closed or fail-open, got "ignore"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config))
+			require.Error(t, err)
+
+			for _, message := range tt.errors {
+				assert.ErrorContains(t, err, message)
+			}
+		})
+	}
+}
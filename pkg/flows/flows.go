@@ -0,0 +1,308 @@
+// Package flows saves and restores the OpenFlow state of every bridge across
+// an ovs-vswitchd restart, the same way the upstream ovs-save script does.
+package flows
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vexxhost/ovsinit/pkg/ovsdb"
+)
+
+const (
+	DEFAULT_PROTOCOL = "OpenFlow14"
+	MANIFEST         = "bridges.json"
+)
+
+// Command runs an external tool and returns its standard output, it can be
+// replaced in tests.
+var Command = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w, output: %s", name, strings.Join(args, " "), err, stderr.String())
+	}
+
+	return output, nil
+}
+
+// Bridge is the saved state of a single bridge
+type Bridge struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+
+	// TLVMap holds the Geneve option mappings of the bridge in the format
+	// of add-tlv-map, which flows matching tun_metadata fields depend on
+	TLVMap []string `json:"tlv_map,omitempty"`
+}
+
+func (b *Bridge) flowsPath(dir string) string {
+	return filepath.Join(dir, b.Name+".flows")
+}
+
+func (b *Bridge) groupsPath(dir string) string {
+	return filepath.Join(dir, b.Name+".groups")
+}
+
+// target is the management socket of the bridge in runDir, which ovs-ofctl
+// would otherwise look for in the run directory it was built with
+func (b *Bridge) target(runDir string) string {
+	return "unix:" + filepath.Join(runDir, b.Name+".mgmt")
+}
+
+// supportsBundle returns whether the protocol of the bridge has bundles,
+// which replace all of its flows atomically
+func (b *Bridge) supportsBundle() bool {
+	version, err := strconv.Atoi(strings.TrimPrefix(b.Protocol, "OpenFlow"))
+	return err == nil && version >= 14
+}
+
+// ofctl runs an ovs-ofctl command against the bridge in runDir
+func ofctl(ctx context.Context, runDir string, bridge Bridge, command string, args ...string) ([]byte, error) {
+	return Command(ctx, "ovs-ofctl", append([]string{"-O", bridge.Protocol, command, bridge.target(runDir)}, args...)...)
+}
+
+// listBridges returns every bridge in the database with the highest protocol it
+// has enabled
+func listBridges(ctx context.Context, client *ovsdb.Client) ([]Bridge, error) {
+	results, err := client.Transact(ctx, "Open_vSwitch", ovsdb.Operation{
+		Op:      ovsdb.OP_SELECT,
+		Table:   "Bridge",
+		Columns: []string{"name", "protocols"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bridges: %w", err)
+	}
+
+	var bridges []Bridge
+	for _, row := range results[0].Rows {
+		var protocols []string
+		for _, protocol := range row.Set("protocols") {
+			protocols = append(protocols, fmt.Sprint(protocol))
+		}
+
+		bridges = append(bridges, Bridge{
+			Name:     row.String("name"),
+			Protocol: highestProtocol(protocols),
+		})
+	}
+
+	slices.SortFunc(bridges, func(a, b Bridge) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return bridges, nil
+}
+
+// Save dumps the TLV map, flows and groups of every bridge in the database
+// into dir, talking to the bridges through their sockets in runDir
+func Save(ctx context.Context, client *ovsdb.Client, runDir, dir string) ([]Bridge, error) {
+	bridges, err := listBridges(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range bridges {
+		bridge := &bridges[i]
+		name := bridge.Name
+
+		bridge.TLVMap, err = dumpTLVMap(ctx, runDir, *bridge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump tlv map for bridge %s: %w", name, err)
+		}
+
+		groups, err := ofctl(ctx, runDir, *bridge, "dump-groups")
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump groups for bridge %s: %w", name, err)
+		}
+
+		if err := os.WriteFile(bridge.groupsPath(dir), filterReply(groups), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save groups for bridge %s: %w", name, err)
+		}
+
+		flows, err := Command(ctx, "ovs-ofctl", "-O", bridge.Protocol, "--no-stats", "--no-names", "dump-flows", bridge.target(runDir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump flows for bridge %s: %w", name, err)
+		}
+
+		if err := os.WriteFile(bridge.flowsPath(dir), filterReply(flows), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save flows for bridge %s: %w", name, err)
+		}
+
+		slog.Info("saved bridge flows", "bridge", name, "protocol", bridge.Protocol)
+	}
+
+	manifest, err := json.Marshal(bridges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, MANIFEST), manifest, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return bridges, nil
+}
+
+// Load reads the bridges saved into dir by Save
+func Load(dir string) ([]Bridge, error) {
+	data, err := os.ReadFile(filepath.Join(dir, MANIFEST))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var bridges []Bridge
+	if err := json.Unmarshal(data, &bridges); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	return bridges, nil
+}
+
+// Restore replays the TLV map, groups and flows of a single bridge saved
+// into dir, talking to the bridge through its socket in runDir.  Every step
+// leaves the bridge in the saved state whatever it already holds, so a failed
+// restore can simply be retried.
+func Restore(ctx context.Context, runDir, dir string, bridge Bridge) error {
+	if err := restoreTLVMap(ctx, runDir, bridge); err != nil {
+		return fmt.Errorf("failed to restore tlv map for bridge %s: %w", bridge.Name, err)
+	}
+
+	if _, err := ofctl(ctx, runDir, bridge, "replace-groups", bridge.groupsPath(dir)); err != nil {
+		return fmt.Errorf("failed to restore groups for bridge %s: %w", bridge.Name, err)
+	}
+
+	args := []string{"-O", bridge.Protocol}
+	if bridge.supportsBundle() {
+		args = append(args, "--bundle")
+	}
+	args = append(args, "replace-flows", bridge.target(runDir), bridge.flowsPath(dir))
+
+	if _, err := Command(ctx, "ovs-ofctl", args...); err != nil {
+		return fmt.Errorf("failed to restore flows for bridge %s: %w", bridge.Name, err)
+	}
+
+	slog.Info("restored bridge flows", "bridge", bridge.Name)
+	return nil
+}
+
+// dumpTLVMap returns the TLV mappings of bridge, such as
+// {class=0xffff,type=0x0,len=4}->tun_metadata0
+func dumpTLVMap(ctx context.Context, runDir string, bridge Bridge) ([]string, error) {
+	output, err := ofctl(ctx, runDir, bridge, "dump-tlv-map")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTLVMap(output), nil
+}
+
+// restoreTLVMap adds the saved TLV mappings the bridge is missing, adding
+// one which already exists fails
+func restoreTLVMap(ctx context.Context, runDir string, bridge Bridge) error {
+	if len(bridge.TLVMap) == 0 {
+		return nil
+	}
+
+	current, err := dumpTLVMap(ctx, runDir, bridge)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, mapping := range bridge.TLVMap {
+		if !slices.Contains(current, mapping) {
+			missing = append(missing, mapping)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	_, err = ofctl(ctx, runDir, bridge, "add-tlv-map", strings.Join(missing, ","))
+	return err
+}
+
+// parseTLVMap parses the mapping table of dump-tlv-map output, like the
+// upstream ovs-save script does.
+func parseTLVMap(output []byte) []string {
+	var mappings []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || !strings.HasPrefix(fields[0], "0x") {
+			continue
+		}
+
+		mappings = append(mappings, fmt.Sprintf("{class=%s,type=%s,len=%s}->%s", fields[0], fields[1], fields[2], fields[3]))
+	}
+
+	return mappings
+}
+
+// SetRestoreWait toggles other_config:flow-restore-wait in the Open_vSwitch table
+func SetRestoreWait(ctx context.Context, client *ovsdb.Client, enabled bool) error {
+	mutations := []ovsdb.Mutation{
+		ovsdb.NewMutation("other_config", "delete", ovsdb.Set{"flow-restore-wait"}),
+	}
+	if enabled {
+		mutations = append(mutations, ovsdb.NewMutation("other_config", "insert", ovsdb.Map{"flow-restore-wait": "true"}))
+	}
+
+	_, err := client.Transact(ctx, "Open_vSwitch", ovsdb.Operation{
+		Op:        ovsdb.OP_MUTATE,
+		Table:     "Open_vSwitch",
+		Mutations: mutations,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set flow-restore-wait to %t: %w", enabled, err)
+	}
+
+	return nil
+}
+
+// highestProtocol picks the highest of the protocols enabled on a bridge,
+// falling back to DEFAULT_PROTOCOL when none are configured.
+func highestProtocol(protocols []string) string {
+	if len(protocols) == 0 {
+		return DEFAULT_PROTOCOL
+	}
+
+	return slices.Max(protocols)
+}
+
+// filterReply strips the OpenFlow reply headers from ovs-ofctl dump output so
+// it can be fed back into add-groups or replace-flows.
+func filterReply(output []byte) []byte {
+	var buf bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "OFPST_") || strings.HasPrefix(line, "NXST_") {
+			continue
+		}
+
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,213 @@
+package flows
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vexxhost/ovsinit/pkg/ovsdb"
+)
+
+func mockCommand(t *testing.T, outputs map[string]string) *[]string {
+	t.Helper()
+
+	var calls []string
+	original := Command
+	Command = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		call := strings.Join(append([]string{name}, args...), " ")
+		calls = append(calls, call)
+
+		return []byte(outputs[call]), nil
+	}
+	t.Cleanup(func() {
+		Command = original
+	})
+
+	return &calls
+}
+
+// fakeDatabase serves the rows of the Bridge table to the returned client
+func fakeDatabase(t *testing.T, bridges ...map[string]any) *ovsdb.Client {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+
+	go func() {
+		dec := json.NewDecoder(serverConn)
+		enc := json.NewEncoder(serverConn)
+
+		for {
+			var req struct {
+				Method string `json:"method"`
+				ID     any    `json:"id"`
+			}
+			if err := dec.Decode(&req); err != nil {
+				return
+			}
+
+			if req.Method != "transact" {
+				continue
+			}
+
+			_ = enc.Encode(map[string]any{
+				"id":     req.ID,
+				"result": []any{map[string]any{"rows": bridges}},
+				"error":  nil,
+			})
+		}
+	}()
+
+	client := ovsdb.NewClient(clientConn)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = serverConn.Close()
+	})
+
+	return client
+}
+
+func TestHighestProtocol(t *testing.T) {
+	tests := []struct {
+		protocols []string
+		want      string
+	}{
+		{protocols: nil, want: DEFAULT_PROTOCOL},
+		{protocols: []string{"OpenFlow13"}, want: "OpenFlow13"},
+		{protocols: []string{"OpenFlow15", "OpenFlow10", "OpenFlow13"}, want: "OpenFlow15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, highestProtocol(tt.protocols))
+		})
+	}
+}
+
+func TestSupportsBundle(t *testing.T) {
+	assert.False(t, (&Bridge{Protocol: "OpenFlow10"}).supportsBundle())
+	assert.False(t, (&Bridge{Protocol: "OpenFlow13"}).supportsBundle())
+	assert.True(t, (&Bridge{Protocol: "OpenFlow14"}).supportsBundle())
+	assert.True(t, (&Bridge{Protocol: "OpenFlow15"}).supportsBundle())
+}
+
+func TestFilterReply(t *testing.T) {
+	output := "OFPST_GROUP_DESC reply (OF1.4) (xid=0x2):\n group_id=1,type=all,bucket=actions=output:1\n\n"
+
+	assert.Equal(t, "group_id=1,type=all,bucket=actions=output:1\n", string(filterReply([]byte(output))))
+}
+
+const tlvMap = `NXT_TLV_TABLE_REPLY (xid=0x4):
+ max option space=256 max fields=64
+ allocated option space=8
+
+ mapping table:
+ class  type  length  match field
+ ------  ----  ------  --------------
+ 0x102  0x80  4       tun_metadata0
+ 0x102  0x81  4       tun_metadata1
+`
+
+func TestParseTLVMap(t *testing.T) {
+	assert.Equal(t, []string{
+		"{class=0x102,type=0x80,len=4}->tun_metadata0",
+		"{class=0x102,type=0x81,len=4}->tun_metadata1",
+	}, parseTLVMap([]byte(tlvMap)))
+
+	assert.Empty(t, parseTLVMap([]byte("NXT_TLV_TABLE_REPLY (xid=0x4):\n max option space=256 max fields=64\n allocated option space=0\n\n mapping table:\n class  type  length  match field\n ------  ----  ------  --------------\n")))
+}
+
+func TestRestoreTLVMapMissing(t *testing.T) {
+	bridge := Bridge{
+		Name:     "br-int",
+		Protocol: "OpenFlow13",
+		TLVMap: []string{
+			"{class=0x102,type=0x80,len=4}->tun_metadata0",
+			"{class=0x102,type=0x81,len=4}->tun_metadata1",
+		},
+	}
+
+	// A previous attempt already added the first mapping
+	calls := mockCommand(t, map[string]string{
+		"ovs-ofctl -O OpenFlow13 dump-tlv-map unix:/run/br-int.mgmt": " 0x102  0x80  4       tun_metadata0\n",
+	})
+
+	require.NoError(t, restoreTLVMap(t.Context(), "/run", bridge))
+	assert.Equal(t, []string{
+		"ovs-ofctl -O OpenFlow13 dump-tlv-map unix:/run/br-int.mgmt",
+		"ovs-ofctl -O OpenFlow13 add-tlv-map unix:/run/br-int.mgmt {class=0x102,type=0x81,len=4}->tun_metadata1",
+	}, *calls)
+
+	// Once all of them exist there is nothing to add
+	calls = mockCommand(t, map[string]string{
+		"ovs-ofctl -O OpenFlow13 dump-tlv-map unix:/run/br-int.mgmt": tlvMap,
+	})
+	require.NoError(t, restoreTLVMap(t.Context(), "/run", bridge))
+	assert.Equal(t, []string{"ovs-ofctl -O OpenFlow13 dump-tlv-map unix:/run/br-int.mgmt"}, *calls)
+}
+
+func TestSaveAndRestore(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	runDir := "/var/run/openvswitch"
+
+	client := fakeDatabase(t,
+		map[string]any{"name": "br-tun", "protocols": []any{"set", []any{"OpenFlow10", "OpenFlow15"}}},
+		map[string]any{"name": "br-int", "protocols": "OpenFlow13"},
+	)
+
+	calls := mockCommand(t, map[string]string{
+		"ovs-ofctl -O OpenFlow13 dump-tlv-map unix:/var/run/openvswitch/br-int.mgmt":                     tlvMap,
+		"ovs-ofctl -O OpenFlow13 dump-groups unix:/var/run/openvswitch/br-int.mgmt":                      "OFPST_GROUP_DESC reply (OF1.3) (xid=0x2):\n group_id=1,type=all\n",
+		"ovs-ofctl -O OpenFlow13 --no-stats --no-names dump-flows unix:/var/run/openvswitch/br-int.mgmt": " priority=0 actions=NORMAL\n",
+	})
+
+	bridges, err := Save(ctx, client, runDir, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []Bridge{{
+		Name:     "br-int",
+		Protocol: "OpenFlow13",
+		TLVMap: []string{
+			"{class=0x102,type=0x80,len=4}->tun_metadata0",
+			"{class=0x102,type=0x81,len=4}->tun_metadata1",
+		},
+	}, {
+		Name:     "br-tun",
+		Protocol: "OpenFlow15",
+	}}, bridges)
+	assert.Contains(t, *calls, "ovs-ofctl -O OpenFlow15 dump-groups unix:/var/run/openvswitch/br-tun.mgmt")
+
+	groups, err := os.ReadFile(filepath.Join(dir, "br-int.groups"))
+	require.NoError(t, err)
+	assert.Equal(t, "group_id=1,type=all\n", string(groups))
+
+	loaded, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, bridges, loaded)
+
+	// The new ovs-vswitchd starts without any TLV mapping, and bundles
+	// need OpenFlow 1.4
+	calls = mockCommand(t, nil)
+	err = Restore(ctx, runDir, dir, loaded[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"ovs-ofctl -O OpenFlow13 dump-tlv-map unix:/var/run/openvswitch/br-int.mgmt",
+		"ovs-ofctl -O OpenFlow13 add-tlv-map unix:/var/run/openvswitch/br-int.mgmt {class=0x102,type=0x80,len=4}->tun_metadata0,{class=0x102,type=0x81,len=4}->tun_metadata1",
+		"ovs-ofctl -O OpenFlow13 replace-groups unix:/var/run/openvswitch/br-int.mgmt " + filepath.Join(dir, "br-int.groups"),
+		"ovs-ofctl -O OpenFlow13 replace-flows unix:/var/run/openvswitch/br-int.mgmt " + filepath.Join(dir, "br-int.flows"),
+	}, *calls)
+
+	calls = mockCommand(t, nil)
+	err = Restore(ctx, runDir, dir, loaded[1])
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"ovs-ofctl -O OpenFlow15 replace-groups unix:/var/run/openvswitch/br-tun.mgmt " + filepath.Join(dir, "br-tun.groups"),
+		"ovs-ofctl -O OpenFlow15 --bundle replace-flows unix:/var/run/openvswitch/br-tun.mgmt " + filepath.Join(dir, "br-tun.flows"),
+	}, *calls)
+}
@@ -0,0 +1,55 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// COMMAND_WAIT_DELAY is how long to wait for the output of a command which
+// timed out, in case it left children behind holding it open
+const COMMAND_WAIT_DELAY = time.Second
+
+// CommandHook runs a command with the environment of ovsinit and the
+// OVSINIT_* variables describing the handoff
+type CommandHook struct {
+	command []string
+}
+
+func Command(command ...string) *CommandHook {
+	return &CommandHook{
+		command: command,
+	}
+}
+
+func (c *CommandHook) String() string {
+	return fmt.Sprintf("command(%s)", strings.Join(c.command, " "))
+}
+
+func (c *CommandHook) Run(ctx context.Context, env Env) error {
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Env = append(os.Environ(), env.Environ()...)
+	cmd.WaitDelay = COMMAND_WAIT_DELAY
+
+	combined, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(combined))
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if output != "" {
+			return fmt.Errorf("%w: %s", err, output)
+		}
+		return err
+	}
+
+	if output != "" {
+		slog.Debug(fmt.Sprintf("%s: output", c.String()), "output", output)
+	}
+
+	return nil
+}
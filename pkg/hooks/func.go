@@ -0,0 +1,94 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HookFunc is a hook implemented in Go, run with the arguments it was
+// configured with
+type HookFunc func(ctx context.Context, env Env, args []string) error
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]HookFunc{}
+)
+
+// Register makes fn available to the configuration as name, replacing any
+// function previously registered under it
+func Register(name string, fn HookFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[name] = fn
+}
+
+// Registered returns the sorted names of the registered functions
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// FuncHook runs a registered function
+type FuncHook struct {
+	name string
+	fn   HookFunc
+	args []string
+}
+
+// Func returns the hook running the function registered as name with args
+func Func(name string, args ...string) (*FuncHook, error) {
+	registryMu.RLock()
+	fn, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown hook function %q, registered: %s", name, strings.Join(Registered(), ", "))
+	}
+
+	return &FuncHook{
+		name: name,
+		fn:   fn,
+		args: args,
+	}, nil
+}
+
+func (f *FuncHook) String() string {
+	return fmt.Sprintf("func(%s)", strings.Join(append([]string{f.name}, f.args...), " "))
+}
+
+func (f *FuncHook) Run(ctx context.Context, env Env) error {
+	return f.fn(ctx, env, f.args)
+}
+
+// ErrNoDaemon is returned by hooks which need the daemon being replaced
+// when none is running
+var ErrNoDaemon = errors.New("no daemon is running")
+
+func init() {
+	// appctl runs its arguments as a command of the daemon being replaced,
+	// such as pausing probes before it exits
+	Register("appctl", func(ctx context.Context, env Env, args []string) error {
+		if len(args) == 0 {
+			return errors.New("appctl requires a command")
+		}
+		if env.Client == nil {
+			return ErrNoDaemon
+		}
+
+		_, err := env.Client.Run(ctx, args[0], args[1:]...)
+		return err
+	})
+}
@@ -0,0 +1,158 @@
+// Package hooks runs site-specific actions at fixed points of the handoff,
+// such as draining BGP announcements before the daemon exits.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+)
+
+const (
+	PHASE_PRE_CLAIM = "pre-claim"
+	PHASE_PRE_EXIT  = "pre-exit"
+	PHASE_POST_EXIT = "post-exit"
+	PHASE_PRE_EXEC  = "pre-exec"
+
+	POLICY_FAIL_CLOSED = "fail-closed"
+	POLICY_FAIL_OPEN   = "fail-open"
+
+	DEFAULT_TIMEOUT = 30 * time.Second
+)
+
+// Phases are the phases hooks run in, in the order of the handoff
+var Phases = []string{PHASE_PRE_CLAIM, PHASE_PRE_EXIT, PHASE_POST_EXIT, PHASE_PRE_EXEC}
+
+type Hook interface {
+	fmt.Stringer
+	Run(ctx context.Context, env Env) error
+}
+
+// Env describes the handoff a hook runs in
+type Env struct {
+	Phase  string
+	Daemon string
+	Binary string
+	Pod    string
+	RunDir string
+
+	// Pid is the pid of the daemon being replaced, 0 when none is running
+	Pid int
+
+	// Client is connected to the daemon being replaced, nil when none is
+	// running or once it exited
+	Client *appctl.Client
+}
+
+// Environ returns the environment variables describing env to commands
+func (e Env) Environ() []string {
+	environ := []string{
+		"OVSINIT_PHASE=" + e.Phase,
+		"OVSINIT_DAEMON=" + e.Daemon,
+		"OVSINIT_BINARY=" + e.Binary,
+		"OVSINIT_POD=" + e.Pod,
+		"OVSINIT_RUN_DIR=" + e.RunDir,
+	}
+
+	if e.Pid != 0 {
+		environ = append(environ, "OVSINIT_PID="+strconv.Itoa(e.Pid))
+	}
+
+	return environ
+}
+
+// Entry is a hook along with how it is run
+type Entry struct {
+	// Name identifies the hook in logs, defaulting to the hook itself
+	Name string
+	Hook Hook
+
+	// Timeout bounds the run of the hook, DEFAULT_TIMEOUT when 0
+	Timeout time.Duration
+
+	// FailOpen continues the handoff when the hook fails instead of
+	// aborting it
+	FailOpen bool
+}
+
+func (e Entry) String() string {
+	if e.Name != "" {
+		return e.Name
+	}
+
+	return e.Hook.String()
+}
+
+// Result is the outcome of a hook and how long it took
+type Result struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+	Err   error
+}
+
+// Hooks holds the ordered hooks of each phase, the zero value has none
+type Hooks struct {
+	phases map[string][]Entry
+}
+
+// Add appends entry to the hooks of phase
+func (h *Hooks) Add(phase string, entry Entry) {
+	if h.phases == nil {
+		h.phases = map[string][]Entry{}
+	}
+
+	h.phases[phase] = append(h.phases[phase], entry)
+}
+
+// Len returns the number of hooks of phase
+func (h *Hooks) Len(phase string) int {
+	return len(h.phases[phase])
+}
+
+// Entries returns the hooks of phase in the order they run
+func (h *Hooks) Entries(phase string) []Entry {
+	return h.phases[phase]
+}
+
+// Run runs the hooks of env.Phase one after the other, stopping at the
+// first one which fails unless it fails open.  The results of the hooks
+// which ran are returned in order.
+func (h *Hooks) Run(ctx context.Context, env Env) ([]Result, error) {
+	var results []Result
+	for _, entry := range h.phases[env.Phase] {
+		slog.Debug("running hook", "phase", env.Phase, "hook", entry.String())
+
+		timeout := entry.Timeout
+		if timeout == 0 {
+			timeout = DEFAULT_TIMEOUT
+		}
+
+		start := time.Now()
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := entry.Hook.Run(hookCtx, env)
+		cancel()
+
+		results = append(results, Result{
+			Name:  entry.String(),
+			Start: start,
+			End:   time.Now(),
+			Err:   err,
+		})
+
+		switch {
+		case err == nil:
+			slog.Info("hook completed successfully", "phase", env.Phase, "hook", entry.String())
+		case entry.FailOpen:
+			slog.Warn("hook failed, continuing", "phase", env.Phase, "hook", entry.String(), "error", err)
+		default:
+			return results, fmt.Errorf("%s hook %s: %w", env.Phase, entry.String(), err)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,145 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Mock hook for testing
+type mockHook struct {
+	name       string
+	shouldFail bool
+	delay      time.Duration
+	ran        *[]string
+}
+
+func (m *mockHook) String() string {
+	return m.name
+}
+
+func (m *mockHook) Run(ctx context.Context, env Env) error {
+	*m.ran = append(*m.ran, m.name)
+
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if m.shouldFail {
+		return assert.AnError
+	}
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []Entry
+		ran     []string
+		wantErr bool
+	}{
+		{
+			name: "in order",
+			entries: []Entry{
+				{Hook: &mockHook{name: "first"}},
+				{Hook: &mockHook{name: "second"}},
+			},
+			ran: []string{"first", "second"},
+		},
+		{
+			name: "fail closed",
+			entries: []Entry{
+				{Hook: &mockHook{name: "first", shouldFail: true}},
+				{Hook: &mockHook{name: "second"}},
+			},
+			ran:     []string{"first"},
+			wantErr: true,
+		},
+		{
+			name: "fail open",
+			entries: []Entry{
+				{Hook: &mockHook{name: "first", shouldFail: true}, FailOpen: true},
+				{Hook: &mockHook{name: "second"}},
+			},
+			ran: []string{"first", "second"},
+		},
+		{
+			name: "timeout",
+			entries: []Entry{
+				{Hook: &mockHook{name: "slow", delay: time.Second}, Timeout: 10 * time.Millisecond},
+				{Hook: &mockHook{name: "second"}},
+			},
+			ran:     []string{"slow"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			var hooks Hooks
+			for _, entry := range tt.entries {
+				entry.Hook.(*mockHook).ran = &ran
+				hooks.Add(PHASE_PRE_EXIT, entry)
+			}
+			hooks.Add(PHASE_POST_EXIT, Entry{Hook: &mockHook{name: "other phase", ran: &ran}})
+
+			results, err := hooks.Run(t.Context(), Env{Phase: PHASE_PRE_EXIT})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.ran, ran)
+			require.Len(t, results, len(tt.ran))
+			for i, result := range results {
+				assert.Equal(t, tt.ran[i], result.Name)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	env := Env{Phase: PHASE_PRE_EXEC, Daemon: "ovnnb_db", Pid: 42}
+
+	hook := Command("/bin/sh", "-c", `test "$OVSINIT_PHASE:$OVSINIT_DAEMON:$OVSINIT_PID" = pre-exec:ovnnb_db:42`)
+	assert.NoError(t, hook.Run(t.Context(), env))
+
+	hook = Command("/bin/sh", "-c", "echo draining failed >&2; exit 3")
+	assert.ErrorContains(t, hook.Run(t.Context(), env), "draining failed")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	hook = Command("/bin/sh", "-c", "exec sleep 5")
+	assert.ErrorIs(t, hook.Run(ctx, env), context.DeadlineExceeded)
+}
+
+func TestFunc(t *testing.T) {
+	var got []string
+	Register("test", func(ctx context.Context, env Env, args []string) error {
+		got = args
+		return nil
+	})
+
+	hook, err := Func("test", "a", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "func(test a b)", hook.String())
+	require.NoError(t, hook.Run(t.Context(), Env{}))
+	assert.Equal(t, []string{"a", "b"}, got)
+
+	_, err = Func("missing")
+	assert.ErrorContains(t, err, `unknown hook function "missing"`)
+
+	hook, err = Func("appctl", "vlog/set", "dbg")
+	require.NoError(t, err)
+	assert.ErrorIs(t, hook.Run(t.Context(), Env{}), ErrNoDaemon)
+}
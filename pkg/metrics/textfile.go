@@ -0,0 +1,115 @@
+// Package metrics writes metrics in the Prometheus exposition format to
+// files picked up by the textfile collector of node_exporter.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TYPE_GAUGE   = "gauge"
+	TYPE_COUNTER = "counter"
+)
+
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Family is a metric with all of its samples
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func writeLabels(w io.Writer, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(labels[name])))
+	}
+
+	_, err := fmt.Fprintf(w, "{%s}", strings.Join(pairs, ","))
+	return err
+}
+
+// Encode writes the families in the text exposition format
+func Encode(w io.Writer, families []Family) error {
+	for _, family := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.Name, helpEscaper.Replace(family.Help), family.Name, family.Type); err != nil {
+			return err
+		}
+
+		for _, sample := range family.Samples {
+			if _, err := io.WriteString(w, family.Name); err != nil {
+				return err
+			}
+			if err := writeLabels(w, sample.Labels); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, " %s\n", strconv.FormatFloat(sample.Value, 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteTextfile writes the families to path, atomically so that the
+// collector never reads a partial file.
+func WriteTextfile(path string, families []Family) error {
+	var buf bytes.Buffer
+	if err := Encode(&buf, families); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var families = []Family{
+	{
+		Name: "ovsinit_handoff_phase_duration_seconds",
+		Help: "Duration of each phase of the handoff",
+		Type: TYPE_GAUGE,
+		Samples: []Sample{
+			{Labels: map[string]string{"phase": "exit", "binary": "ovs-vswitchd"}, Value: 0.25},
+			{Labels: map[string]string{"phase": `file_removal("x")`, "binary": "ovs-vswitchd"}, Value: 1.5e-3},
+		},
+	},
+	{
+		Name:    "ovsinit_succession_generation",
+		Help:    "Fencing token of the succession claim",
+		Type:    TYPE_GAUGE,
+		Samples: []Sample{{Value: 42}},
+	},
+}
+
+const encoded = `# HELP ovsinit_handoff_phase_duration_seconds Duration of each phase of the handoff
+# TYPE ovsinit_handoff_phase_duration_seconds gauge
+ovsinit_handoff_phase_duration_seconds{binary="ovs-vswitchd",phase="exit"} 0.25
+ovsinit_handoff_phase_duration_seconds{binary="ovs-vswitchd",phase="file_removal(\"x\")"} 0.0015
+# HELP ovsinit_succession_generation Fencing token of the succession claim
+# TYPE ovsinit_succession_generation gauge
+ovsinit_succession_generation 42
+`
+
+func TestEncode(t *testing.T) {
+	var buf strings.Builder
+	require.NoError(t, Encode(&buf, families))
+
+	assert.Equal(t, encoded, buf.String())
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ovsinit.prom")
+
+	require.NoError(t, os.WriteFile(path, []byte("stale\n"), 0o644))
+	require.NoError(t, WriteTextfile(path, families))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, string(data))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary file should be renamed")
+}
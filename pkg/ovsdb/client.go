@@ -0,0 +1,217 @@
+// Package ovsdb implements a client for the OVSDB management protocol
+// (RFC 7047) on top of the same JSON-RPC codec used by appctl.
+package ovsdb
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/cenkalti/rpc2"
+	"github.com/cenkalti/rpc2/jsonrpc"
+)
+
+const (
+	DEFAULT_ENDPOINT = "unix:/run/openvswitch/db.sock"
+)
+
+var ErrInvalidEndpoint = errors.New("invalid endpoint")
+
+type Client struct {
+	*rpc2.Client
+
+	mu       sync.Mutex
+	monitors map[string]func(TableUpdates)
+}
+
+func NewClient(conn io.ReadWriteCloser) *Client {
+	c := &Client{
+		Client:   rpc2.NewClientWithCodec(jsonrpc.NewJSONCodec(conn)),
+		monitors: make(map[string]func(TableUpdates)),
+	}
+	c.SetBlocking(true)
+
+	c.Handle("echo", func(_ *rpc2.Client, args []any, reply *[]any) error {
+		*reply = args
+		return nil
+	})
+	c.Handle("update", func(_ *rpc2.Client, args []json.RawMessage, _ *struct{}) error {
+		return c.handleUpdate(args)
+	})
+
+	go c.Run()
+
+	return c
+}
+
+func (c *Client) Close() error {
+	return c.Client.Close()
+}
+
+// Dial connects to an OVSDB endpoint such as "unix:/run/openvswitch/db.sock"
+// or "tcp:127.0.0.1:6640".
+func Dial(endpoint string) (*Client, error) {
+	return DialTLS(endpoint, nil)
+}
+
+// DialTLS connects to an OVSDB endpoint, using config for "ssl:" endpoints
+func DialTLS(endpoint string, config *tls.Config) (*Client, error) {
+	protocol, address, ok := strings.Cut(endpoint, ":")
+	if !ok || address == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEndpoint, endpoint)
+	}
+
+	var conn net.Conn
+	var err error
+
+	switch protocol {
+	case "unix", "tcp":
+		conn, err = net.Dial(protocol, address)
+	case "ssl":
+		if config == nil {
+			return nil, fmt.Errorf("%w: %s requires a TLS configuration", ErrInvalidEndpoint, endpoint)
+		}
+		conn, err = tls.Dial("tcp", address, config)
+	default:
+		return nil, fmt.Errorf("%w: unsupported protocol %s", ErrInvalidEndpoint, protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn), nil
+}
+
+func (c *Client) Echo(ctx context.Context) error {
+	var reply []any
+	return c.CallWithContext(ctx, "echo", []any{"ovsinit"}, &reply)
+}
+
+func (c *Client) ListDbs(ctx context.Context) ([]string, error) {
+	var dbs []string
+	if err := c.CallWithContext(ctx, "list_dbs", []any{}, &dbs); err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	return dbs, nil
+}
+
+func (c *Client) GetSchema(ctx context.Context, db string) (*Schema, error) {
+	var schema Schema
+	if err := c.CallWithContext(ctx, "get_schema", []any{db}, &schema); err != nil {
+		return nil, fmt.Errorf("failed to get schema for %s: %w", db, err)
+	}
+
+	return &schema, nil
+}
+
+// Transact runs the operations as a single transaction, returning an error
+// if any of the operations failed.
+func (c *Client) Transact(ctx context.Context, db string, ops ...Operation) ([]OperationResult, error) {
+	params := make([]any, 0, len(ops)+1)
+	params = append(params, db)
+	for _, op := range ops {
+		params = append(params, op)
+	}
+
+	var results []OperationResult
+	if err := c.CallWithContext(ctx, "transact", params, &results); err != nil {
+		return nil, fmt.Errorf("failed to transact on %s: %w", db, err)
+	}
+
+	for i, result := range results {
+		if result.Error != "" {
+			return results, &TransactionError{Index: i, Result: result}
+		}
+	}
+
+	if len(results) < len(ops) {
+		return results, fmt.Errorf("transaction returned %d results for %d operations", len(results), len(ops))
+	}
+
+	return results, nil
+}
+
+// Select returns the rows of table matching all of the conditions
+func (c *Client) Select(ctx context.Context, db, table string, where ...Condition) ([]Row, error) {
+	results, err := c.Transact(ctx, db, Operation{
+		Op:    OP_SELECT,
+		Table: table,
+		Where: where,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results[0].Rows, nil
+}
+
+// Monitor starts monitoring the tables in requests, calling handler with
+// every update received after the initial contents which are returned.
+func (c *Client) Monitor(ctx context.Context, db, id string, requests map[string]MonitorRequest, handler func(TableUpdates)) (TableUpdates, error) {
+	c.mu.Lock()
+	if _, ok := c.monitors[id]; ok {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("monitor %s already exists", id)
+	}
+	c.monitors[id] = handler
+	c.mu.Unlock()
+
+	var updates TableUpdates
+	if err := c.CallWithContext(ctx, "monitor", []any{db, id, requests}, &updates); err != nil {
+		c.removeMonitor(id)
+		return nil, fmt.Errorf("failed to monitor %s: %w", db, err)
+	}
+
+	return updates, nil
+}
+
+func (c *Client) MonitorCancel(ctx context.Context, id string) error {
+	defer c.removeMonitor(id)
+
+	var reply map[string]any
+	if err := c.CallWithContext(ctx, "monitor_cancel", []any{id}, &reply); err != nil {
+		return fmt.Errorf("failed to cancel monitor %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (c *Client) removeMonitor(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.monitors, id)
+}
+
+func (c *Client) handleUpdate(args []json.RawMessage) error {
+	if len(args) != 2 {
+		return fmt.Errorf("invalid update with %d params", len(args))
+	}
+
+	var id string
+	if err := json.Unmarshal(args[0], &id); err != nil {
+		return fmt.Errorf("invalid monitor id: %w", err)
+	}
+
+	var updates TableUpdates
+	if err := json.Unmarshal(args[1], &updates); err != nil {
+		return fmt.Errorf("invalid table updates: %w", err)
+	}
+
+	c.mu.Lock()
+	handler := c.monitors[id]
+	c.mu.Unlock()
+
+	if handler != nil {
+		handler(updates)
+	}
+
+	return nil
+}
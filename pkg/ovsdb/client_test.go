@@ -0,0 +1,178 @@
+package ovsdb
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     any               `json:"id"`
+}
+
+// fakeServer answers requests on conn using the handler, which returns the
+// JSON result for a request.
+func fakeServer(t *testing.T, handler func(enc *json.Encoder, req request) any) *Client {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+
+	go func() {
+		dec := json.NewDecoder(serverConn)
+		enc := json.NewEncoder(serverConn)
+
+		for {
+			var req request
+			if err := dec.Decode(&req); err != nil {
+				return
+			}
+
+			// Replies to our own echo requests
+			if req.Method == "" {
+				continue
+			}
+
+			_ = enc.Encode(map[string]any{
+				"id":     req.ID,
+				"result": handler(enc, req),
+				"error":  nil,
+			})
+		}
+	}()
+
+	client := NewClient(clientConn)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = serverConn.Close()
+	})
+
+	return client
+}
+
+func TestDialInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "db.sock", "udp:127.0.0.1:6640", "ssl:127.0.0.1:6640"} {
+		_, err := Dial(endpoint)
+		assert.ErrorIs(t, err, ErrInvalidEndpoint, endpoint)
+	}
+}
+
+func TestDialLeaderInvalidEndpoint(t *testing.T) {
+	_, err := DialLeader(t.Context(), []string{"ssl:127.0.0.1:6641"}, "OVN_Southbound", nil)
+	assert.ErrorIs(t, err, ErrInvalidEndpoint)
+	assert.NotErrorIs(t, err, ErrNoLeader)
+}
+
+func TestListDbs(t *testing.T) {
+	client := fakeServer(t, func(_ *json.Encoder, req request) any {
+		assert.Equal(t, "list_dbs", req.Method)
+		return []string{"Open_vSwitch", "_Server"}
+	})
+
+	dbs, err := client.ListDbs(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Open_vSwitch", "_Server"}, dbs)
+}
+
+func TestGetSchema(t *testing.T) {
+	client := fakeServer(t, func(_ *json.Encoder, req request) any {
+		return json.RawMessage(`{"name":"Open_vSwitch","version":"8.8.0","tables":{"Bridge":{"columns":{"name":{"type":"string"}}}}}`)
+	})
+
+	schema, err := client.GetSchema(t.Context(), "Open_vSwitch")
+	require.NoError(t, err)
+	assert.Equal(t, "8.8.0", schema.Version)
+	assert.Contains(t, schema.Tables["Bridge"].Columns, "name")
+}
+
+func TestTransact(t *testing.T) {
+	client := fakeServer(t, func(_ *json.Encoder, req request) any {
+		assert.Equal(t, "transact", req.Method)
+		assert.JSONEq(t, `"Open_vSwitch"`, string(req.Params[0]))
+		assert.JSONEq(t, `{"op":"select","table":"Bridge","where":[["name","==","br-int"]]}`, string(req.Params[1]))
+
+		return json.RawMessage(`[{"rows":[{"_uuid":["uuid","2f5b1c7e-0000-0000-0000-000000000001"],"name":"br-int","protocols":["set",["OpenFlow13","OpenFlow15"]],"external_ids":["map",[["bridge-id","br-int"]]]}]}]`)
+	})
+
+	rows, err := client.Select(t.Context(), "Open_vSwitch", "Bridge", NewCondition("name", "==", "br-int"))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+
+	assert.Equal(t, UUID("2f5b1c7e-0000-0000-0000-000000000001"), rows[0].UUID())
+	assert.Equal(t, "br-int", rows[0].String("name"))
+	assert.Equal(t, Set{"OpenFlow13", "OpenFlow15"}, rows[0].Set("protocols"))
+	assert.Equal(t, map[string]string{"bridge-id": "br-int"}, rows[0].Map("external_ids"))
+}
+
+func TestTransactError(t *testing.T) {
+	client := fakeServer(t, func(_ *json.Encoder, req request) any {
+		return json.RawMessage(`[{"error":"constraint violation","details":"duplicate name"}]`)
+	})
+
+	_, err := client.Transact(t.Context(), "Open_vSwitch", Operation{
+		Op:    OP_INSERT,
+		Table: "Bridge",
+		Row:   map[string]any{"name": "br-int"},
+	})
+
+	var txErr *TransactionError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, 0, txErr.Index)
+	assert.Equal(t, "constraint violation", txErr.Result.Error)
+}
+
+func TestMonitor(t *testing.T) {
+	client := fakeServer(t, func(enc *json.Encoder, req request) any {
+		switch req.Method {
+		case "monitor":
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				_ = enc.Encode(map[string]any{
+					"method": "update",
+					"params": []any{"bridges", json.RawMessage(`{"Bridge":{"u2":{"new":{"name":"br-ex"}}}}`)},
+					"id":     nil,
+				})
+			}()
+
+			return json.RawMessage(`{"Bridge":{"u1":{"new":{"name":"br-int"}}}}`)
+		case "monitor_cancel":
+			return map[string]any{}
+		}
+
+		return nil
+	})
+
+	updates := make(chan TableUpdates, 1)
+	initial, err := client.Monitor(t.Context(), "Open_vSwitch", "bridges", map[string]MonitorRequest{
+		"Bridge": {Columns: []string{"name"}},
+	}, func(u TableUpdates) {
+		updates <- u
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "br-int", initial["Bridge"]["u1"].New.String("name"))
+
+	select {
+	case u := <-updates:
+		assert.Equal(t, "br-ex", u["Bridge"]["u2"].New.String("name"))
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for update")
+	}
+
+	require.NoError(t, client.MonitorCancel(t.Context(), "bridges"))
+}
+
+func TestIsLeader(t *testing.T) {
+	client := fakeServer(t, func(_ *json.Encoder, req request) any {
+		assert.JSONEq(t, `"_Server"`, string(req.Params[0]))
+		return json.RawMessage(`[{"rows":[{"name":"OVN_Northbound","model":"clustered","leader":true}]}]`)
+	})
+
+	leader, err := client.IsLeader(t.Context(), "OVN_Northbound")
+	require.NoError(t, err)
+	assert.True(t, leader)
+}
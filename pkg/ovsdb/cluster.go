@@ -0,0 +1,79 @@
+package ovsdb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+const (
+	SERVER_DB = "_Server"
+)
+
+var ErrNoLeader = errors.New("no cluster leader found")
+
+// Convert converts db to schema online, which for clustered databases must be
+// sent to the leader.
+func (c *Client) Convert(ctx context.Context, db string, schema *Schema) error {
+	var reply map[string]any
+	if err := c.CallWithContext(ctx, "convert", []any{db, schema}, &reply); err != nil {
+		return fmt.Errorf("failed to convert %s: %w", db, err)
+	}
+
+	return nil
+}
+
+// IsLeader reports whether the server is the cluster leader for db, using the
+// Database table of the _Server database.
+func (c *Client) IsLeader(ctx context.Context, db string) (bool, error) {
+	rows, err := c.Select(ctx, SERVER_DB, "Database", NewCondition("name", "==", db))
+	if err != nil {
+		return false, err
+	}
+
+	if len(rows) == 0 {
+		return false, fmt.Errorf("database %s not found", db)
+	}
+
+	var database struct {
+		Model  string `ovsdb:"model"`
+		Leader bool   `ovsdb:"leader"`
+	}
+	if err := Unmarshal(rows[0], &database); err != nil {
+		return false, err
+	}
+
+	return database.Model == "clustered" && database.Leader, nil
+}
+
+// DialLeader connects to each endpoint in turn and returns a client for the
+// first one which is the cluster leader for db, using config for "ssl:"
+// endpoints.  Endpoints which cannot be dialed at all, such as "ssl:" ones
+// without config, fail with ErrInvalidEndpoint rather than ErrNoLeader.
+func DialLeader(ctx context.Context, endpoints []string, db string, config *tls.Config) (*Client, error) {
+	var errs []error
+
+	for _, endpoint := range endpoints {
+		client, err := DialTLS(endpoint, config)
+		if errors.Is(err, ErrInvalidEndpoint) {
+			return nil, err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+			continue
+		}
+
+		leader, err := client.IsLeader(ctx, db)
+		if err == nil && leader {
+			return client, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint, err))
+		}
+
+		_ = client.Close()
+	}
+
+	return nil, errors.Join(append([]error{ErrNoLeader}, errs...)...)
+}
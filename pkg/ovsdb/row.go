@@ -0,0 +1,260 @@
+package ovsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Row is a database row, with OVSDB atoms decoded into UUID, Set and Map
+type Row map[string]any
+
+func (r *Row) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	row := make(Row, len(raw))
+	for column, value := range raw {
+		decoded, err := decodeValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to decode column %s: %w", column, err)
+		}
+		row[column] = decoded
+	}
+
+	*r = row
+	return nil
+}
+
+// UUID returns the _uuid column of the row
+func (r Row) UUID() UUID {
+	uuid, _ := r["_uuid"].(UUID)
+	return uuid
+}
+
+// String returns a string column, or "" for an empty optional value
+func (r Row) String(column string) string {
+	for _, v := range r.Set(column) {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+
+	return ""
+}
+
+// Set returns a column as a set, wrapping single atoms
+func (r Row) Set(column string) Set {
+	switch v := r[column].(type) {
+	case nil:
+		return nil
+	case Set:
+		return v
+	default:
+		return Set{v}
+	}
+}
+
+// Map returns a map column with its keys and values formatted as strings
+func (r Row) Map(column string) map[string]string {
+	m, ok := r[column].(Map)
+	if !ok {
+		return nil
+	}
+
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[fmt.Sprint(k)] = fmt.Sprint(v)
+	}
+
+	return result
+}
+
+// Unmarshal copies the columns of row into the fields of the struct pointed
+// to by v which carry an `ovsdb:"column"` tag.
+func Unmarshal(row Row, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected pointer to struct, got %T", v)
+	}
+	rv = rv.Elem()
+
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+
+		column := field.Tag.Get("ovsdb")
+		if column == "" {
+			continue
+		}
+
+		if err := assign(rv.Field(i), row[column]); err != nil {
+			return fmt.Errorf("failed to decode column %s: %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+func assign(dst reflect.Value, value any) error {
+	if value == nil {
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Slice:
+		set, ok := value.(Set)
+		if !ok {
+			set = Set{value}
+		}
+
+		slice := reflect.MakeSlice(dst.Type(), len(set), len(set))
+		for i, item := range set {
+			if err := assign(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+	case reflect.Map:
+		m, ok := value.(Map)
+		if !ok {
+			if set, ok := value.(Set); ok && len(set) == 0 {
+				return nil
+			}
+			return fmt.Errorf("expected map, got %T", value)
+		}
+
+		result := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, v := range m {
+			key := reflect.New(dst.Type().Key()).Elem()
+			if err := assign(key, k); err != nil {
+				return err
+			}
+
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, v); err != nil {
+				return err
+			}
+
+			result.SetMapIndex(key, elem)
+		}
+		dst.Set(result)
+		return nil
+	}
+
+	// Optional columns are encoded as sets with zero or one element
+	if set, ok := value.(Set); ok {
+		switch len(set) {
+		case 0:
+			return nil
+		case 1:
+			value = set[0]
+		default:
+			return fmt.Errorf("expected single value, got set of %d", len(set))
+		}
+	}
+
+	src := reflect.ValueOf(value)
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case src.Type().ConvertibleTo(dst.Type()) && src.Kind() != reflect.String && dst.Kind() != reflect.String:
+		// Numbers decode as int64 or float64, allow them into other numeric fields
+		dst.Set(src.Convert(dst.Type()))
+	case src.Kind() == reflect.String && dst.Kind() == reflect.String:
+		dst.SetString(src.String())
+	default:
+		return fmt.Errorf("cannot assign %T to %s", value, dst.Type())
+	}
+
+	return nil
+}
+
+// decodeAtom decodes a scalar, keeping integers as int64 so that large values
+// survive being written back.
+func decodeAtom(data json.RawMessage) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var atom any
+	if err := dec.Decode(&atom); err != nil {
+		return nil, err
+	}
+
+	number, ok := atom.(json.Number)
+	if !ok {
+		return atom, nil
+	}
+
+	if i, err := number.Int64(); err == nil {
+		return i, nil
+	}
+
+	return number.Float64()
+}
+
+// decodeValue converts an OVSDB <value> into its Go representation
+func decodeValue(data json.RawMessage) (any, error) {
+	var array []json.RawMessage
+	if err := json.Unmarshal(data, &array); err != nil {
+		return decodeAtom(data)
+	}
+
+	if len(array) != 2 {
+		return nil, fmt.Errorf("invalid value %s", data)
+	}
+
+	var tag string
+	if err := json.Unmarshal(array[0], &tag); err != nil {
+		return nil, fmt.Errorf("invalid value tag %s", array[0])
+	}
+
+	switch tag {
+	case "uuid", "named-uuid":
+		var uuid string
+		if err := json.Unmarshal(array[1], &uuid); err != nil {
+			return nil, err
+		}
+		return UUID(uuid), nil
+	case "set":
+		var items []json.RawMessage
+		if err := json.Unmarshal(array[1], &items); err != nil {
+			return nil, err
+		}
+
+		set := make(Set, 0, len(items))
+		for _, item := range items {
+			value, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, value)
+		}
+		return set, nil
+	case "map":
+		var pairs [][2]json.RawMessage
+		if err := json.Unmarshal(array[1], &pairs); err != nil {
+			return nil, err
+		}
+
+		m := make(Map, len(pairs))
+		for _, pair := range pairs {
+			key, err := decodeValue(pair[0])
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeValue(pair[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown value tag %s", tag)
+	}
+}
@@ -0,0 +1,74 @@
+package ovsdb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bridge struct {
+	UUID        UUID              `ovsdb:"_uuid"`
+	Name        string            `ovsdb:"name"`
+	Ports       []UUID            `ovsdb:"ports"`
+	Protocols   []string          `ovsdb:"protocols"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+	DatapathID  string            `ovsdb:"datapath_id"`
+	STPEnable   bool              `ovsdb:"stp_enable"`
+	FloodVLANs  []int             `ovsdb:"flood_vlans"`
+	Ignored     string
+}
+
+func TestUnmarshal(t *testing.T) {
+	var row Row
+	err := json.Unmarshal([]byte(`{
+		"_uuid": ["uuid", "u1"],
+		"name": "br-int",
+		"ports": ["uuid", "p1"],
+		"protocols": ["set", ["OpenFlow13", "OpenFlow15"]],
+		"external_ids": ["map", [["bridge-id", "br-int"]]],
+		"datapath_id": ["set", []],
+		"stp_enable": true,
+		"flood_vlans": ["set", [10, 20]]
+	}`), &row)
+	require.NoError(t, err)
+
+	var b bridge
+	require.NoError(t, Unmarshal(row, &b))
+
+	assert.Equal(t, bridge{
+		UUID:        "u1",
+		Name:        "br-int",
+		Ports:       []UUID{"p1"},
+		Protocols:   []string{"OpenFlow13", "OpenFlow15"},
+		ExternalIDs: map[string]string{"bridge-id": "br-int"},
+		STPEnable:   true,
+		FloodVLANs:  []int{10, 20},
+	}, b)
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	var b bridge
+	assert.Error(t, Unmarshal(Row{}, b))
+	assert.Error(t, Unmarshal(Row{"name": true}, &b))
+}
+
+func TestMarshalValues(t *testing.T) {
+	data, err := json.Marshal([]any{
+		UUID("u1"),
+		NamedUUID("new_bridge"),
+		Set{"a"},
+		Set(nil),
+		Map{"b": "2", "a": "1"},
+	})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `[
+		["uuid", "u1"],
+		["named-uuid", "new_bridge"],
+		["set", ["a"]],
+		["set", []],
+		["map", [["a", "1"], ["b", "2"]]]
+	]`, string(data))
+}
@@ -0,0 +1,135 @@
+package ovsdb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Schema is a database schema as returned by "get_schema"
+type Schema struct {
+	Name    string                 `json:"name"`
+	Version string                 `json:"version,omitempty"`
+	Cksum   string                 `json:"cksum,omitempty"`
+	Tables  map[string]TableSchema `json:"tables"`
+}
+
+type TableSchema struct {
+	Columns map[string]ColumnSchema `json:"columns"`
+	MaxRows int                     `json:"maxRows,omitempty"`
+	IsRoot  bool                    `json:"isRoot,omitempty"`
+	Indexes [][]string              `json:"indexes,omitempty"`
+}
+
+type ColumnSchema struct {
+	Type      ColumnType `json:"type"`
+	Ephemeral bool       `json:"ephemeral,omitempty"`
+	Mutable   *bool      `json:"mutable,omitempty"`
+}
+
+// ColumnType is the <type> of a column, keeping the original encoding so
+// schemas round-trip unchanged.
+type ColumnType struct {
+	Key   string
+	Value string
+	Min   int
+	// Max is -1 for "unlimited"
+	Max int
+
+	raw json.RawMessage
+}
+
+// IsScalar reports whether the column holds exactly one atom
+func (t ColumnType) IsScalar() bool {
+	return t.Min == 1 && t.Max == 1 && t.Value == ""
+}
+
+// IsMap reports whether the column holds key/value pairs
+func (t ColumnType) IsMap() bool {
+	return t.Value != ""
+}
+
+func (t ColumnType) MarshalJSON() ([]byte, error) {
+	if t.raw != nil {
+		return t.raw, nil
+	}
+
+	if t.IsScalar() {
+		return json.Marshal(t.Key)
+	}
+
+	typ := map[string]any{"key": t.Key, "min": t.Min}
+	if t.Value != "" {
+		typ["value"] = t.Value
+	}
+
+	if t.Max < 0 {
+		typ["max"] = "unlimited"
+	} else {
+		typ["max"] = t.Max
+	}
+
+	return json.Marshal(typ)
+}
+
+func (t *ColumnType) UnmarshalJSON(data []byte) error {
+	*t = ColumnType{Min: 1, Max: 1, raw: append(json.RawMessage(nil), data...)}
+
+	var atomic string
+	if err := json.Unmarshal(data, &atomic); err == nil {
+		t.Key = atomic
+		return nil
+	}
+
+	var typ struct {
+		Key   json.RawMessage `json:"key"`
+		Value json.RawMessage `json:"value"`
+		Min   *int            `json:"min"`
+		Max   json.RawMessage `json:"max"`
+	}
+	if err := json.Unmarshal(data, &typ); err != nil {
+		return fmt.Errorf("invalid column type %s: %w", data, err)
+	}
+
+	var err error
+	if t.Key, err = baseType(typ.Key); err != nil {
+		return err
+	}
+
+	if typ.Value != nil {
+		if t.Value, err = baseType(typ.Value); err != nil {
+			return err
+		}
+	}
+
+	if typ.Min != nil {
+		t.Min = *typ.Min
+	}
+
+	if typ.Max != nil {
+		var unlimited string
+		if err := json.Unmarshal(typ.Max, &unlimited); err == nil && unlimited == "unlimited" {
+			t.Max = -1
+		} else if err := json.Unmarshal(typ.Max, &t.Max); err != nil {
+			return fmt.Errorf("invalid max %s: %w", typ.Max, err)
+		}
+	}
+
+	return nil
+}
+
+// baseType returns the atomic type of a <base-type>
+func baseType(data json.RawMessage) (string, error) {
+	var atomic string
+	if err := json.Unmarshal(data, &atomic); err == nil {
+		return atomic, nil
+	}
+
+	var base struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &base); err != nil || base.Type == "" {
+		return "", fmt.Errorf("invalid base type %s", data)
+	}
+
+	return base.Type, nil
+}
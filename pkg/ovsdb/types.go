@@ -0,0 +1,198 @@
+package ovsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	OP_INSERT  = "insert"
+	OP_SELECT  = "select"
+	OP_UPDATE  = "update"
+	OP_MUTATE  = "mutate"
+	OP_DELETE  = "delete"
+	OP_WAIT    = "wait"
+	OP_COMMENT = "comment"
+)
+
+// UUID is a row reference, encoded as ["uuid", "<uuid>"]
+type UUID string
+
+func (u UUID) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{"uuid", string(u)})
+}
+
+// NamedUUID references a row inserted in the same transaction
+type NamedUUID string
+
+func (u NamedUUID) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{"named-uuid", string(u)})
+}
+
+// Set is an OVSDB set, encoded as ["set", [...]]
+type Set []any
+
+func (s Set) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		s = Set{}
+	}
+
+	return json.Marshal([]any{"set", []any(s)})
+}
+
+// Map is an OVSDB map, encoded as ["map", [[key, value], ...]]
+type Map map[any]any
+
+func (m Map) MarshalJSON() ([]byte, error) {
+	pairs := make([][2]any, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, [2]any{k, v})
+	}
+
+	// Keep the encoding stable so transactions can be compared
+	sort.Slice(pairs, func(i, j int) bool {
+		return fmt.Sprint(pairs[i][0]) < fmt.Sprint(pairs[j][0])
+	})
+
+	return json.Marshal([]any{"map", pairs})
+}
+
+// Condition is a [column, function, value] triple used in "where" clauses
+type Condition [3]any
+
+func NewCondition(column, function string, value any) Condition {
+	return Condition{column, function, value}
+}
+
+// Mutation is a [column, mutator, value] triple used by "mutate" operations
+type Mutation [3]any
+
+func NewMutation(column, mutator string, value any) Mutation {
+	return Mutation{column, mutator, value}
+}
+
+// Operation is a single operation inside a "transact" request
+type Operation struct {
+	Op        string
+	Table     string
+	Where     []Condition
+	Row       map[string]any
+	Rows      []map[string]any
+	Columns   []string
+	Mutations []Mutation
+	UUIDName  string
+	Until     string
+	Comment   string
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	op := map[string]any{"op": o.Op}
+
+	if o.Op == OP_COMMENT {
+		op["comment"] = o.Comment
+		return json.Marshal(op)
+	}
+
+	op["table"] = o.Table
+
+	switch o.Op {
+	case OP_INSERT:
+		op["row"] = o.Row
+		if o.UUIDName != "" {
+			op["uuid-name"] = o.UUIDName
+		}
+		return json.Marshal(op)
+	case OP_UPDATE:
+		op["row"] = o.Row
+	case OP_MUTATE:
+		op["mutations"] = o.Mutations
+	case OP_WAIT:
+		op["rows"] = o.Rows
+		op["until"] = o.Until
+		op["columns"] = o.Columns
+	}
+
+	if o.Op == OP_SELECT && o.Columns != nil {
+		op["columns"] = o.Columns
+	}
+
+	where := o.Where
+	if where == nil {
+		where = []Condition{}
+	}
+	op["where"] = where
+
+	return json.Marshal(op)
+}
+
+// OperationResult is the result of a single operation of a transaction
+type OperationResult struct {
+	Count   int    `json:"count,omitempty"`
+	UUID    UUID   `json:"-"`
+	Rows    []Row  `json:"rows,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+func (r *OperationResult) UnmarshalJSON(data []byte) error {
+	type result OperationResult
+	var raw struct {
+		result
+		UUID json.RawMessage `json:"uuid"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = OperationResult(raw.result)
+
+	if raw.UUID != nil {
+		value, err := decodeValue(raw.UUID)
+		if err != nil {
+			return err
+		}
+
+		uuid, ok := value.(UUID)
+		if !ok {
+			return fmt.Errorf("invalid uuid %s", raw.UUID)
+		}
+		r.UUID = uuid
+	}
+
+	return nil
+}
+
+type TransactionError struct {
+	Index  int
+	Result OperationResult
+}
+
+func (e *TransactionError) Error() string {
+	if e.Result.Details != "" {
+		return fmt.Sprintf("operation %d failed: %s: %s", e.Index, e.Result.Error, e.Result.Details)
+	}
+
+	return fmt.Sprintf("operation %d failed: %s", e.Index, e.Result.Error)
+}
+
+// MonitorRequest selects the columns and kind of changes to monitor for a table
+type MonitorRequest struct {
+	Columns []string       `json:"columns,omitempty"`
+	Select  *MonitorSelect `json:"select,omitempty"`
+}
+
+type MonitorSelect struct {
+	Initial bool `json:"initial"`
+	Insert  bool `json:"insert"`
+	Delete  bool `json:"delete"`
+	Modify  bool `json:"modify"`
+}
+
+// TableUpdates maps table names to the rows that changed, keyed by UUID
+type TableUpdates map[string]map[UUID]RowUpdate
+
+type RowUpdate struct {
+	Old Row `json:"old,omitempty"`
+	New Row `json:"new,omitempty"`
+}
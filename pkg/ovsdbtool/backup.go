@@ -0,0 +1,166 @@
+package ovsdbtool
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_BACKUPS = 5
+)
+
+// DbVersion returns the schema version of the database at path without
+// replaying its transactions.
+func DbVersion(path string) (string, error) {
+	schema, err := ReadDbSchema(path)
+	if err != nil {
+		return "", err
+	}
+
+	return schema.Version, nil
+}
+
+// BackupPath returns the path of the backup of path taken at schema version
+func BackupPath(path, version string) string {
+	return fmt.Sprintf("%s.%s.bak", path, version)
+}
+
+// Backup copies the database at path to BackupPath, named after its current
+// schema version, and returns the path of the backup.
+func Backup(path string) (string, error) {
+	version, err := DbVersion(path)
+	if err != nil {
+		return "", err
+	}
+
+	backup := BackupPath(path, version)
+	if err := copyFile(path, backup); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+
+	return backup, nil
+}
+
+// RestoreBackup replaces the database at path with its backup taken at the
+// given schema version, reporting false if there is no such backup.
+func RestoreBackup(path, version string) (bool, error) {
+	backup := BackupPath(path, version)
+	if _, err := os.Stat(backup); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err := copyFile(backup, path); err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", backup, err)
+	}
+
+	return true, nil
+}
+
+// PruneBackups removes all but the keep most recent backups of path
+func PruneBackups(path string, keep int) error {
+	matches, err := filepath.Glob(path + ".*.bak")
+	if err != nil {
+		return fmt.Errorf("failed to list backups of %s: %w", path, err)
+	}
+
+	type backup struct {
+		path    string
+		modTime int64
+	}
+
+	backups := make([]backup, 0, len(matches))
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: match, modTime: info.ModTime().UnixNano()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime > backups[j].modTime
+	})
+
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove backup %s: %w", backups[i].path, err)
+		}
+	}
+
+	return nil
+}
+
+// CompareVersions compares two "x.y.z" schema versions, returning -1, 0 or 1
+func CompareVersions(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(partsB[i])
+		}
+
+		switch {
+		case numA < numB:
+			return -1
+		case numA > numB:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// copyFile atomically copies src to dst, keeping the permissions of src
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,79 @@
+package ovsdbtool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	path := copyGolden(t)
+
+	backup, err := Backup(path)
+	require.NoError(t, err)
+	assert.Equal(t, path+".1.0.0.bak", backup)
+
+	require.NoError(t, Convert(path, "testdata/v2.ovsschema"))
+
+	version, err := DbVersion(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", version)
+
+	restored, err := RestoreBackup(path, "3.0.0")
+	require.NoError(t, err)
+	assert.False(t, restored)
+
+	restored, err = RestoreBackup(path, "1.0.0")
+	require.NoError(t, err)
+	assert.True(t, restored)
+
+	version, err = DbVersion(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", version)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestPruneBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.db")
+
+	now := time.Now()
+	for i, version := range []string{"1.0.0", "1.1.0", "2.0.0", "2.1.0"} {
+		backup := BackupPath(path, version)
+		require.NoError(t, os.WriteFile(backup, nil, 0640))
+
+		modTime := now.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(backup, modTime, modTime))
+	}
+
+	require.NoError(t, PruneBackups(path, 2))
+
+	matches, err := filepath.Glob(path + ".*.bak")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{BackupPath(path, "2.0.0"), BackupPath(path, "2.1.0")}, matches)
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"8.3.0", "8.3.0", 0},
+		{"8.3.0", "8.4.0", -1},
+		{"8.10.0", "8.9.1", 1},
+		{"8.3", "8.3.0", 0},
+		{"7.99.99", "8.0.0", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.want, CompareVersions(tt.a, tt.b))
+		})
+	}
+}
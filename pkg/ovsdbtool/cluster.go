@@ -0,0 +1,122 @@
+package ovsdbtool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// ClusterHeader is the first record of a clustered database file
+type ClusterHeader struct {
+	Name            string   `json:"name"`
+	LocalAddress    string   `json:"local_address"`
+	ServerID        string   `json:"server_id"`
+	ClusterID       string   `json:"cluster_id,omitempty"`
+	RemoteAddresses []string `json:"-"`
+}
+
+func (h *ClusterHeader) UnmarshalJSON(data []byte) error {
+	type header ClusterHeader
+	var raw struct {
+		header
+		RemoteAddresses json.RawMessage `json:"remote_addresses"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*h = ClusterHeader(raw.header)
+
+	if raw.RemoteAddresses == nil {
+		return nil
+	}
+
+	// A single address is written as a string, several as a set
+	var address string
+	if err := json.Unmarshal(raw.RemoteAddresses, &address); err == nil {
+		h.RemoteAddresses = []string{address}
+		return nil
+	}
+
+	var set []json.RawMessage
+	if err := json.Unmarshal(raw.RemoteAddresses, &set); err != nil || len(set) != 2 {
+		return fmt.Errorf("invalid remote_addresses %s", raw.RemoteAddresses)
+	}
+
+	return json.Unmarshal(set[1], &h.RemoteAddresses)
+}
+
+// IsClustered reports whether the database at path uses clustered storage
+func IsClustered(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	log := NewLogReader(file)
+	if _, err := log.Next(); err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return log.Magic() == MAGIC_CLUSTERED, nil
+}
+
+// ReadClusterHeader returns the header of the clustered database at path
+func ReadClusterHeader(path string) (*ClusterHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	log := NewLogReader(file)
+
+	record, err := log.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header from %s: %w", path, err)
+	}
+
+	if log.Magic() != MAGIC_CLUSTERED {
+		return nil, fmt.Errorf("%s: database is not clustered", path)
+	}
+
+	var header ClusterHeader
+	if err := json.Unmarshal(record, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse header from %s: %w", path, err)
+	}
+
+	return &header, nil
+}
+
+// CreateCluster creates the database of the first member of a new cluster.
+// Unlike standalone databases, the raft storage is written by ovsdb-tool.
+func CreateCluster(ctx context.Context, path, schemaPath, local string) error {
+	if schemaPath == "" {
+		schemaPath = DEFAULT_SCHEMA
+	}
+
+	return ovsdbTool(ctx, "create-cluster", path, schemaPath, local)
+}
+
+// JoinCluster creates the database of a member joining an existing cluster
+// through the remote addresses of its other members.
+func JoinCluster(ctx context.Context, path, name, local string, remotes []string) error {
+	args := append([]string{"join-cluster", path, name, local}, remotes...)
+	return ovsdbTool(ctx, args...)
+}
+
+func ovsdbTool(ctx context.Context, args ...string) error {
+	output, err := exec.CommandContext(ctx, "ovsdb-tool", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ovsdb-tool %s failed: %w, output: %s", args[0], err, output)
+	}
+
+	return nil
+}
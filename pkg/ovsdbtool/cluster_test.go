@@ -0,0 +1,73 @@
+package ovsdbtool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeClusterHeader(t *testing.T, header map[string]any) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ovnnb_db.db")
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+
+	require.NoError(t, NewLogWriter(file, MAGIC_CLUSTERED).Write(header))
+
+	return path
+}
+
+func TestReadClusterHeader(t *testing.T) {
+	path := writeClusterHeader(t, map[string]any{
+		"name":             "OVN_Northbound",
+		"local_address":    "tcp:10.0.0.2:6643",
+		"server_id":        "a1b2c3d4-0000-0000-0000-000000000002",
+		"remote_addresses": []any{"set", []string{"tcp:10.0.0.1:6643", "tcp:10.0.0.3:6643"}},
+	})
+
+	clustered, err := IsClustered(path)
+	require.NoError(t, err)
+	assert.True(t, clustered)
+
+	header, err := ReadClusterHeader(path)
+	require.NoError(t, err)
+	assert.Equal(t, &ClusterHeader{
+		Name:            "OVN_Northbound",
+		LocalAddress:    "tcp:10.0.0.2:6643",
+		ServerID:        "a1b2c3d4-0000-0000-0000-000000000002",
+		RemoteAddresses: []string{"tcp:10.0.0.1:6643", "tcp:10.0.0.3:6643"},
+	}, header)
+
+	_, err = Read(path)
+	assert.ErrorIs(t, err, ErrClustered)
+}
+
+func TestReadClusterHeaderSingleRemote(t *testing.T) {
+	path := writeClusterHeader(t, map[string]any{
+		"name":             "OVN_Southbound",
+		"local_address":    "tcp:10.0.0.2:6644",
+		"server_id":        "a1b2c3d4-0000-0000-0000-000000000002",
+		"remote_addresses": "tcp:10.0.0.1:6644",
+	})
+
+	header, err := ReadClusterHeader(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tcp:10.0.0.1:6644"}, header.RemoteAddresses)
+}
+
+func TestReadClusterHeaderStandalone(t *testing.T) {
+	clustered, err := IsClustered("testdata/conf.db")
+	require.NoError(t, err)
+	assert.False(t, clustered)
+
+	_, err = ReadClusterHeader("testdata/conf.db")
+	assert.Error(t, err)
+}
@@ -0,0 +1,462 @@
+// Package ovsdbtool reads and writes standalone OVSDB database files, covering
+// the subset of ovsdb-tool used to set up databases before ovsdb-server runs.
+package ovsdbtool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/ovsdb"
+)
+
+const (
+	DEFAULT_SCHEMA = "/usr/share/openvswitch/vswitch.ovsschema"
+)
+
+var ErrClustered = errors.New("database is clustered")
+
+// Database is the in-memory contents of a database file
+type Database struct {
+	Schema *ovsdb.Schema
+	Tables map[string]map[ovsdb.UUID]ovsdb.Row
+}
+
+// ReadSchema reads a .ovsschema file
+func ReadSchema(path string) (*ovsdb.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+
+	var schema ovsdb.Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", path, err)
+	}
+
+	return &schema, nil
+}
+
+// ReadDbSchema reads the schema of the standalone database at path from its
+// first record, without replaying its transactions.
+func ReadDbSchema(path string) (*ovsdb.Schema, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return readDbSchema(path, NewLogReader(file))
+}
+
+func readDbSchema(path string, log *LogReader) (*ovsdb.Schema, error) {
+	record, err := log.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema from %s: %w", path, err)
+	}
+
+	if log.Magic() != MAGIC_STANDALONE {
+		return nil, fmt.Errorf("%s: %w", path, ErrClustered)
+	}
+
+	var schema ovsdb.Schema
+	if err := json.Unmarshal(record, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema from %s: %w", path, err)
+	}
+
+	return &schema, nil
+}
+
+// Read loads a standalone database file, replaying all of its transactions
+// up to a truncated one at its end, which is discarded like ovsdb-server does.
+func Read(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	log := NewLogReader(file)
+
+	schema, err := readDbSchema(path, log)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{
+		Schema: schema,
+		Tables: make(map[string]map[ovsdb.UUID]ovsdb.Row),
+	}
+
+	for {
+		record, err := log.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, ErrTruncated) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		if err := db.apply(record); err != nil {
+			return nil, fmt.Errorf("failed to apply transaction from %s: %w", path, err)
+		}
+	}
+
+	return db, nil
+}
+
+// apply replays a single transaction record onto the database
+func (db *Database) apply(record json.RawMessage) error {
+	var txn map[string]json.RawMessage
+	if err := json.Unmarshal(record, &txn); err != nil {
+		return err
+	}
+
+	var isDiff bool
+	if raw, ok := txn["_is_diff"]; ok {
+		if err := json.Unmarshal(raw, &isDiff); err != nil {
+			return fmt.Errorf("invalid _is_diff: %w", err)
+		}
+	}
+
+	for table, raw := range txn {
+		// Members starting with "_" are transaction metadata, such as "_date"
+		if strings.HasPrefix(table, "_") {
+			continue
+		}
+
+		tableSchema, ok := db.Schema.Tables[table]
+		if !ok {
+			return fmt.Errorf("unknown table %s", table)
+		}
+
+		var rows map[ovsdb.UUID]*ovsdb.Row
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return fmt.Errorf("invalid rows for table %s: %w", table, err)
+		}
+
+		if db.Tables[table] == nil {
+			db.Tables[table] = make(map[ovsdb.UUID]ovsdb.Row)
+		}
+
+		for uuid, changes := range rows {
+			if changes == nil {
+				delete(db.Tables[table], uuid)
+				continue
+			}
+
+			row, ok := db.Tables[table][uuid]
+			if !ok {
+				row = ovsdb.Row{}
+				db.Tables[table][uuid] = row
+			}
+
+			for column, value := range *changes {
+				columnSchema, ok := tableSchema.Columns[column]
+				if !ok {
+					// Skip internal columns such as "_version"
+					if strings.HasPrefix(column, "_") {
+						continue
+					}
+					return fmt.Errorf("unknown column %s in table %s", column, table)
+				}
+
+				if isDiff {
+					if old, exists := row[column]; exists {
+						value = applyDiff(old, value, columnSchema.Type)
+					}
+				}
+
+				row[column] = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// Write atomically replaces path with a compacted copy of the database
+func (db *Database) Write(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary database: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("failed to set database permissions: %w", err)
+		}
+	}
+
+	if err := db.write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync database: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace database %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (db *Database) write(w io.Writer) error {
+	log := NewLogWriter(w, MAGIC_STANDALONE)
+
+	if err := log.Write(db.Schema); err != nil {
+		return fmt.Errorf("failed to write schema: %w", err)
+	}
+
+	txn := map[string]any{}
+	for table, rows := range db.Tables {
+		if len(rows) == 0 {
+			continue
+		}
+
+		contents := make(map[ovsdb.UUID]ovsdb.Row, len(rows))
+		for uuid, row := range rows {
+			contents[uuid] = row
+		}
+		txn[table] = contents
+	}
+
+	if len(txn) == 0 {
+		return nil
+	}
+
+	txn["_date"] = time.Now().UnixMilli()
+
+	if err := log.Write(txn); err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	return nil
+}
+
+// Create writes a new empty database at path using the schema at schemaPath,
+// or DEFAULT_SCHEMA if it is empty.
+func Create(path, schemaPath string) error {
+	if schemaPath == "" {
+		schemaPath = DEFAULT_SCHEMA
+	}
+
+	schema, err := ReadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create database %s: %w", path, err)
+	}
+
+	if err := NewLogWriter(file, MAGIC_STANDALONE).Write(schema); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write schema: %w", err)
+	}
+
+	return file.Close()
+}
+
+// NeedsConversion reports whether the database at path uses a schema which
+// differs from the one at schemaPath, reading only its schema record.
+func NeedsConversion(path, schemaPath string) (bool, error) {
+	current, err := ReadDbSchema(path)
+	if err != nil {
+		return false, err
+	}
+
+	schema, err := ReadSchema(schemaPath)
+	if err != nil {
+		return false, err
+	}
+
+	return !SchemaEqual(current, schema), nil
+}
+
+// SchemaEqual compares two schemas, including their version and checksum
+func SchemaEqual(a, b *ovsdb.Schema) bool {
+	if a.Name != b.Name || a.Version != b.Version || a.Cksum != b.Cksum {
+		return false
+	}
+
+	// Compare the canonical encoding so equivalent column types match
+	encodedA, errA := json.Marshal(a.Tables)
+	encodedB, errB := json.Marshal(b.Tables)
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	var tablesA, tablesB any
+	if json.Unmarshal(encodedA, &tablesA) != nil || json.Unmarshal(encodedB, &tablesB) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(tablesA, tablesB)
+}
+
+// Convert rewrites the database at path to use the schema at schemaPath,
+// dropping tables and columns which no longer exist.
+func Convert(path, schemaPath string) error {
+	db, err := Read(path)
+	if err != nil {
+		return err
+	}
+
+	schema, err := ReadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	converted, err := db.Convert(schema)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s: %w", path, err)
+	}
+
+	return converted.Write(path)
+}
+
+// Convert returns a copy of the database using schema
+func (db *Database) Convert(schema *ovsdb.Schema) (*Database, error) {
+	converted := &Database{
+		Schema: schema,
+		Tables: make(map[string]map[ovsdb.UUID]ovsdb.Row),
+	}
+
+	for table, rows := range db.Tables {
+		tableSchema, ok := schema.Tables[table]
+		if !ok {
+			continue
+		}
+
+		converted.Tables[table] = make(map[ovsdb.UUID]ovsdb.Row, len(rows))
+		for uuid, row := range rows {
+			newRow := ovsdb.Row{}
+
+			for column, value := range row {
+				columnSchema, ok := tableSchema.Columns[column]
+				if !ok {
+					continue
+				}
+
+				value, err := convertValue(value, columnSchema.Type)
+				if err != nil {
+					return nil, fmt.Errorf("table %s row %s column %s: %w", table, uuid, column, err)
+				}
+
+				newRow[column] = value
+			}
+
+			converted.Tables[table][uuid] = newRow
+		}
+	}
+
+	return converted, nil
+}
+
+// convertValue adapts a value to a column type whose cardinality changed
+func convertValue(value any, typ ovsdb.ColumnType) (any, error) {
+	set, isSet := value.(ovsdb.Set)
+
+	switch {
+	case typ.IsMap():
+		if isSet && len(set) == 0 {
+			return ovsdb.Map{}, nil
+		}
+		if _, ok := value.(ovsdb.Map); !ok {
+			return nil, fmt.Errorf("cannot convert %T to map", value)
+		}
+	case typ.IsScalar():
+		if isSet {
+			if len(set) != 1 {
+				return nil, fmt.Errorf("cannot convert set of %d values to scalar", len(set))
+			}
+			return set[0], nil
+		}
+	case isSet && typ.Max >= 0 && len(set) > typ.Max:
+		return nil, fmt.Errorf("set of %d values exceeds maximum of %d", len(set), typ.Max)
+	}
+
+	return value, nil
+}
+
+// applyDiff applies a diff as written by ovsdb-server in "_is_diff" records,
+// where set elements and map keys present in the diff are toggled.
+func applyDiff(old, diff any, typ ovsdb.ColumnType) any {
+	if typ.IsScalar() {
+		return diff
+	}
+
+	if typ.IsMap() {
+		oldMap, _ := old.(ovsdb.Map)
+		diffMap, _ := diff.(ovsdb.Map)
+
+		result := make(ovsdb.Map, len(oldMap))
+		for k, v := range oldMap {
+			result[k] = v
+		}
+
+		for k, v := range diffMap {
+			if current, ok := result[k]; ok && current == v {
+				delete(result, k)
+			} else {
+				result[k] = v
+			}
+		}
+
+		return result
+	}
+
+	result := ovsdb.Set{}
+	removed := map[any]bool{}
+	for _, item := range toSet(diff) {
+		removed[item] = true
+	}
+
+	for _, item := range toSet(old) {
+		if removed[item] {
+			delete(removed, item)
+			continue
+		}
+		result = append(result, item)
+	}
+
+	for _, item := range toSet(diff) {
+		if removed[item] {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func toSet(value any) ovsdb.Set {
+	if set, ok := value.(ovsdb.Set); ok {
+		return set
+	}
+
+	return ovsdb.Set{value}
+}
@@ -0,0 +1,138 @@
+package ovsdbtool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vexxhost/ovsinit/pkg/ovsdb"
+)
+
+const (
+	OVS_UUID    = ovsdb.UUID("0a0a0a0a-0000-0000-0000-000000000001")
+	BRIDGE_UUID = ovsdb.UUID("0b0b0b0b-0000-0000-0000-000000000001")
+)
+
+// copyGolden copies the golden database into a temporary directory
+func copyGolden(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/conf.db")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "conf.db")
+	require.NoError(t, os.WriteFile(path, data, 0640))
+
+	return path
+}
+
+func TestRead(t *testing.T) {
+	db, err := Read("testdata/conf.db")
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.0.0", db.Schema.Version)
+
+	ovs := db.Tables["Open_vSwitch"][OVS_UUID]
+	assert.Equal(t, int64(2), ovs["next_cfg"])
+	assert.Equal(t, map[string]string{"flow-restore-wait": "true"}, ovs.Map("other_config"))
+
+	bridge := db.Tables["Bridge"][BRIDGE_UUID]
+	assert.Equal(t, "br-int", bridge.String("name"))
+	assert.Equal(t, ovsdb.Set{"OpenFlow15"}, bridge.Set("protocols"))
+
+	assert.Empty(t, db.Tables["Legacy"])
+}
+
+func TestReadCorrupted(t *testing.T) {
+	path := copyGolden(t)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-5] = 'x'
+	require.NoError(t, os.WriteFile(path, data, 0640))
+
+	_, err = Read(path)
+	assert.ErrorIs(t, err, ErrInvalidRecord)
+}
+
+func TestReadTornTail(t *testing.T) {
+	path := copyGolden(t)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data[:len(data)-5], 0640))
+
+	// The torn transaction is discarded, the earlier ones are kept
+	db, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", db.Schema.Version)
+	assert.Contains(t, db.Tables["Bridge"], BRIDGE_UUID)
+
+	needsConversion, err := NeedsConversion(path, "testdata/v1.ovsschema")
+	require.NoError(t, err)
+	assert.False(t, needsConversion)
+
+	needsConversion, err = NeedsConversion(path, "testdata/v2.ovsschema")
+	require.NoError(t, err)
+	assert.True(t, needsConversion)
+}
+
+func TestCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.db")
+
+	require.NoError(t, Create(path, "testdata/v1.ovsschema"))
+	assert.Error(t, Create(path, "testdata/v1.ovsschema"), "existing database must not be overwritten")
+
+	db, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", db.Schema.Version)
+	assert.Empty(t, db.Tables)
+
+	needsConversion, err := NeedsConversion(path, "testdata/v1.ovsschema")
+	require.NoError(t, err)
+	assert.False(t, needsConversion)
+}
+
+func TestConvert(t *testing.T) {
+	path := copyGolden(t)
+
+	needsConversion, err := NeedsConversion(path, "testdata/v2.ovsschema")
+	require.NoError(t, err)
+	assert.True(t, needsConversion)
+
+	require.NoError(t, Convert(path, "testdata/v2.ovsschema"))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	needsConversion, err = NeedsConversion(path, "testdata/v2.ovsschema")
+	require.NoError(t, err)
+	assert.False(t, needsConversion)
+
+	db, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", db.Schema.Version)
+	assert.NotContains(t, db.Tables, "Legacy")
+
+	bridge := db.Tables["Bridge"][BRIDGE_UUID]
+	assert.Equal(t, "system", bridge["datapath_type"])
+	assert.Equal(t, ovsdb.Set{"OpenFlow15"}, bridge.Set("protocols"))
+	assert.Equal(t, BRIDGE_UUID, db.Tables["Open_vSwitch"][OVS_UUID]["bridges"])
+}
+
+func TestConvertIncompatible(t *testing.T) {
+	db, err := Read("testdata/conf.db")
+	require.NoError(t, err)
+
+	schema, err := ReadSchema("testdata/v2.ovsschema")
+	require.NoError(t, err)
+
+	db.Tables["Bridge"][BRIDGE_UUID]["datapath_type"] = ovsdb.Set{}
+
+	_, err = db.Convert(schema)
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package ovsdbtool
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAGIC_STANDALONE = "OVSDB JSON"
+	MAGIC_CLUSTERED  = "OVSDB CLUSTER"
+)
+
+var (
+	ErrInvalidRecord = errors.New("invalid record")
+
+	// ErrTruncated is returned for a record cut short by the end of the
+	// file, which is left behind when ovsdb-server is killed while
+	// appending it.  ovsdb-server discards it, and so does Read.
+	ErrTruncated = fmt.Errorf("%w: truncated", ErrInvalidRecord)
+)
+
+// LogReader reads the records of an OVSDB log file, which are JSON texts each
+// preceded by a "<magic> <length> <sha1>" header line.
+type LogReader struct {
+	r     *bufio.Reader
+	magic string
+}
+
+func NewLogReader(r io.Reader) *LogReader {
+	return &LogReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Magic returns the magic of the records read so far
+func (l *LogReader) Magic() string {
+	return l.magic
+}
+
+// Next returns the next record, or io.EOF when there are no more
+func (l *LogReader) Next() (json.RawMessage, error) {
+	header, err := l.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && header == "" {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("%w header", ErrTruncated)
+	}
+
+	magic, length, sum, err := parseHeader(strings.TrimSuffix(header, "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	if l.magic == "" {
+		l.magic = magic
+	} else if l.magic != magic {
+		return nil, fmt.Errorf("%w: magic %q does not match %q", ErrInvalidRecord, magic, l.magic)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(l.r, data); err != nil {
+		return nil, fmt.Errorf("%w data", ErrTruncated)
+	}
+
+	actual := sha1.Sum(data)
+	if hex.EncodeToString(actual[:]) != sum {
+		return nil, fmt.Errorf("%w: sha1 mismatch", ErrInvalidRecord)
+	}
+
+	return json.RawMessage(data), nil
+}
+
+func parseHeader(header string) (string, int, string, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return "", 0, "", fmt.Errorf("%w: malformed header %q", ErrInvalidRecord, header)
+	}
+
+	magic := strings.Join(fields[:len(fields)-2], " ")
+	if magic != MAGIC_STANDALONE && magic != MAGIC_CLUSTERED {
+		return "", 0, "", fmt.Errorf("%w: unknown magic %q", ErrInvalidRecord, magic)
+	}
+
+	length, err := strconv.Atoi(fields[len(fields)-2])
+	if err != nil || length < 0 {
+		return "", 0, "", fmt.Errorf("%w: malformed length in header %q", ErrInvalidRecord, header)
+	}
+
+	return magic, length, fields[len(fields)-1], nil
+}
+
+// LogWriter writes records in the OVSDB log format
+type LogWriter struct {
+	w     io.Writer
+	magic string
+}
+
+func NewLogWriter(w io.Writer, magic string) *LogWriter {
+	return &LogWriter{
+		w:     w,
+		magic: magic,
+	}
+}
+
+// Write encodes v as JSON and appends it as a record
+func (l *LogWriter) Write(v any) error {
+	var buf bytes.Buffer
+
+	// Encode terminates the record with the newline ovsdb-server expects
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	data := buf.Bytes()
+
+	sum := sha1.Sum(data)
+	if _, err := fmt.Fprintf(l.w, "%s %d %s\n", l.magic, len(data), hex.EncodeToString(sum[:])); err != nil {
+		return err
+	}
+
+	_, err := l.w.Write(data)
+	return err
+}
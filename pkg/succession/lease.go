@@ -0,0 +1,269 @@
+package succession
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	HISTORY_ANNOTATION = "ovsinit.vexxhost.com/history"
+)
+
+// LeaseBackend stores the succession history in a coordination.k8s.io/v1
+// Lease, so it works without sharing a run directory between pods.  The
+// holder of the Lease is the current owner and the history is kept in an
+// annotation, whose most recent entry carries the fencing token.
+type LeaseBackend struct {
+	client     kubernetes.Interface
+	namespace  string
+	name       string
+	maxHistory int
+}
+
+// LeaseName returns the name of the Lease of daemon on node, replacing the
+// characters Kubernetes does not allow in names, such as the underscore of
+// ovnnb_db, with dashes and truncating it to the longest name allowed.
+func LeaseName(daemon, node string) string {
+	name := []rune(strings.ToLower(fmt.Sprintf("ovsinit-%s-%s", daemon, node)))
+	for i, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '.' {
+			name[i] = '-'
+		}
+	}
+
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		name = name[:validation.DNS1123SubdomainMaxLength]
+	}
+
+	return strings.Trim(string(name), "-.")
+}
+
+func NewLeaseBackend(client kubernetes.Interface, namespace, name string) *LeaseBackend {
+	return &LeaseBackend{
+		client:     client,
+		namespace:  namespace,
+		name:       name,
+		maxHistory: MAX_HISTORY,
+	}
+}
+
+// SetMaxHistory sets how many entries are kept in the history, at least
+// one so that the latest claim is never trimmed
+func (b *LeaseBackend) SetMaxHistory(n int) {
+	b.maxHistory = max(n, 1)
+}
+
+func (b *LeaseBackend) Close() error {
+	return nil
+}
+
+func (b *LeaseBackend) get(ctx context.Context) (*coordinationv1.Lease, error) {
+	lease, err := b.client.CoordinationV1().Leases(b.namespace).Get(ctx, b.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lease %s/%s: %w", b.namespace, b.name, err)
+	}
+
+	return lease, nil
+}
+
+func leaseHistory(lease *coordinationv1.Lease) ([]HistoryEntry, error) {
+	if lease == nil {
+		return nil, nil
+	}
+
+	data, ok := lease.Annotations[HISTORY_ANNOTATION]
+	if !ok {
+		return nil, nil
+	}
+
+	var history []HistoryEntry
+	if err := json.Unmarshal([]byte(data), &history); err != nil {
+		return nil, fmt.Errorf("failed to decode history of lease %s: %w", lease.Name, err)
+	}
+
+	return history, nil
+}
+
+func setLeaseHistory(lease *coordinationv1.Lease, history []HistoryEntry) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[HISTORY_ANNOTATION] = string(data)
+
+	return nil
+}
+
+// leaseDuration returns the duration of the lease for entry, nil if it
+// never expires
+func leaseDuration(entry HistoryEntry, now time.Time) *int32 {
+	if entry.ExpiresAt == nil {
+		return nil
+	}
+
+	seconds := int32(math.Ceil(entry.ExpiresAt.Sub(now).Seconds()))
+	return &seconds
+}
+
+func (b *LeaseBackend) Claim(ctx context.Context, entry HistoryEntry) (HistoryEntry, error) {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := b.get(ctx)
+		if err != nil {
+			return err
+		}
+
+		create := lease == nil
+		if create {
+			lease = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      b.name,
+					Namespace: b.namespace,
+				},
+			}
+		}
+
+		history, err := leaseHistory(lease)
+		if err != nil {
+			return err
+		}
+
+		entry.ID = 1
+		if len(history) > 0 {
+			entry.ID = history[0].ID + 1
+		}
+
+		history = append([]HistoryEntry{entry}, history...)
+		if len(history) > b.maxHistory {
+			history = history[:b.maxHistory]
+		}
+
+		if err := setLeaseHistory(lease, history); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		renewTime := metav1.NewMicroTime(now)
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+
+		lease.Spec.HolderIdentity = &entry.Owner
+		lease.Spec.AcquireTime = &renewTime
+		lease.Spec.RenewTime = &renewTime
+		lease.Spec.LeaseDurationSeconds = leaseDuration(entry, now)
+		lease.Spec.LeaseTransitions = &transitions
+
+		leases := b.client.CoordinationV1().Leases(b.namespace)
+		if create {
+			_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Lost the race to create it, retry as an update
+				return apierrors.NewConflict(coordinationv1.Resource("leases"), b.name, err)
+			}
+		} else {
+			_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		}
+
+		return err
+	})
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (b *LeaseBackend) Update(ctx context.Context, entry HistoryEntry) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := b.get(ctx)
+		if err != nil {
+			return err
+		}
+		if lease == nil {
+			return fmt.Errorf("lease %s/%s does not exist", b.namespace, b.name)
+		}
+
+		history, err := leaseHistory(lease)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for i := range history {
+			if history[i].ID == entry.ID {
+				history[i] = entry
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("history entry %d not found in lease %s/%s", entry.ID, b.namespace, b.name)
+		}
+
+		if err := setLeaseHistory(lease, history); err != nil {
+			return err
+		}
+
+		// Updating the current claim renews the lease
+		if history[0].ID == entry.ID {
+			now := time.Now()
+			renewTime := metav1.NewMicroTime(now)
+			lease.Spec.RenewTime = &renewTime
+			lease.Spec.LeaseDurationSeconds = leaseDuration(entry, now)
+		}
+
+		_, err = b.client.CoordinationV1().Leases(b.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (b *LeaseBackend) Current(ctx context.Context) (*HistoryEntry, error) {
+	history, err := b.History(ctx)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+
+	return &history[0], nil
+}
+
+func (b *LeaseBackend) WasOwner(ctx context.Context, identity string) (bool, error) {
+	history, err := b.History(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range history {
+		if entry.Owner == identity {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (b *LeaseBackend) History(ctx context.Context) ([]HistoryEntry, error) {
+	lease, err := b.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return leaseHistory(lease)
+}
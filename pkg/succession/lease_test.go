@@ -0,0 +1,161 @@
+package succession
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func createLeaseMarker(t *testing.T, client kubernetes.Interface, podName string) *Marker {
+	t.Helper()
+
+	return NewWithBackend(NewLeaseBackend(client, "openstack", "ovsinit-ovs-vswitchd-node-1"), podName)
+}
+
+func TestLeaseName(t *testing.T) {
+	tests := []struct {
+		daemon string
+		node   string
+		want   string
+	}{
+		{daemon: "ovs-vswitchd", node: "compute-1", want: "ovsinit-ovs-vswitchd-compute-1"},
+		{daemon: "ovnnb_db", node: "ctl-1.example.com", want: "ovsinit-ovnnb-db-ctl-1.example.com"},
+		{daemon: "ovnsb_db", node: "Node_2", want: "ovsinit-ovnsb-db-node-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			name := LeaseName(tt.daemon, tt.node)
+			assert.Equal(t, tt.want, name)
+			assert.Empty(t, validation.IsDNS1123Subdomain(name))
+		})
+	}
+}
+
+func TestLeaseSuccession(t *testing.T) {
+	ctx := t.Context()
+	client := fake.NewClientset()
+
+	pod1 := createLeaseMarker(t, client, "pod-1")
+
+	shouldProceed, isReplaced, err := pod1.CheckSuccession(ctx)
+	require.NoError(t, err)
+	assert.True(t, shouldProceed)
+	assert.False(t, isReplaced)
+
+	require.NoError(t, pod1.Claim(ctx))
+
+	pod2 := createLeaseMarker(t, client, "pod-2")
+
+	shouldProceed, isReplaced, err = pod2.CheckSuccession(ctx)
+	require.NoError(t, err)
+	assert.True(t, shouldProceed)
+	assert.False(t, isReplaced)
+
+	require.NoError(t, pod2.Claim(ctx))
+
+	shouldProceed, isReplaced, err = pod1.CheckSuccession(ctx)
+	require.NoError(t, err)
+	assert.False(t, shouldProceed)
+	assert.True(t, isReplaced)
+
+	owner, err := pod1.CurrentOwner(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "pod-2", owner)
+
+	history, err := pod1.GetHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, uint(2), history[0].ID)
+	assert.Equal(t, "pod-2", history[0].Owner)
+	assert.Equal(t, uint(1), history[1].ID)
+	assert.Equal(t, "pod-1", history[1].Owner)
+
+	require.NoError(t, pod2.RecordOutcome(ctx, OUTCOME_EXEC, 250*time.Millisecond))
+
+	history, err = pod2.GetHistory(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, OUTCOME_EXEC, history[0].Outcome)
+	assert.Equal(t, int64(250), history[0].HandoffDurationMs)
+	assert.Equal(t, OUTCOME_CLAIMED, history[1].Outcome)
+
+	lease, err := client.CoordinationV1().Leases("openstack").Get(ctx, "ovsinit-ovs-vswitchd-node-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), *lease.Spec.LeaseTransitions)
+	assert.Nil(t, lease.Spec.LeaseDurationSeconds, "executed claims must not expire")
+}
+
+func TestLeaseFencing(t *testing.T) {
+	ctx := t.Context()
+	client := fake.NewClientset()
+
+	pod1 := createLeaseMarker(t, client, "pod-1")
+	require.NoError(t, pod1.Claim(ctx))
+	require.NoError(t, pod1.Renew(ctx))
+
+	lease, err := client.CoordinationV1().Leases("openstack").Get(ctx, "ovsinit-ovs-vswitchd-node-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, lease.Spec.LeaseDurationSeconds)
+	assert.Equal(t, int32(DEFAULT_TTL.Seconds()), *lease.Spec.LeaseDurationSeconds)
+
+	pod2 := createLeaseMarker(t, client, "pod-2")
+	pod2.SetTTL(10 * time.Millisecond)
+	require.NoError(t, pod2.Claim(ctx))
+	assert.Equal(t, pod1.Token()+1, pod2.Token())
+
+	assert.ErrorIs(t, pod1.Validate(ctx), ErrFenced)
+
+	time.Sleep(20 * time.Millisecond)
+
+	shouldProceed, isReplaced, err := pod1.CheckSuccession(ctx)
+	require.NoError(t, err)
+	assert.True(t, shouldProceed)
+	assert.False(t, isReplaced)
+}
+
+func TestLeaseMaxHistory(t *testing.T) {
+	ctx := t.Context()
+	client := fake.NewClientset()
+
+	for _, n := range []int{-1, 0} {
+		backend := NewLeaseBackend(client, "openstack", fmt.Sprintf("ovsinit-max-history%d", n))
+		backend.SetMaxHistory(n)
+
+		marker := NewWithBackend(backend, "pod-1")
+		require.NoError(t, marker.Claim(ctx))
+
+		history, err := marker.GetHistory(ctx)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, "pod-1", history[0].Owner)
+	}
+}
+
+func TestLeaseHistoryLimit(t *testing.T) {
+	ctx := t.Context()
+	client := fake.NewClientset()
+
+	for i := 1; i <= MAX_HISTORY+5; i++ {
+		marker := createLeaseMarker(t, client, fmt.Sprintf("pod-%d", i))
+		require.NoError(t, marker.Claim(ctx))
+	}
+
+	marker := createLeaseMarker(t, client, "pod-1")
+
+	history, err := marker.GetHistory(ctx)
+	require.NoError(t, err)
+	assert.Len(t, history, MAX_HISTORY)
+	assert.Equal(t, fmt.Sprintf("pod-%d", MAX_HISTORY+5), history[0].Owner)
+
+	// The oldest owners have been trimmed, so pod-1 looks like a new pod
+	wasOwner, err := marker.WasOwner(ctx)
+	require.NoError(t, err)
+	assert.False(t, wasOwner)
+}
@@ -0,0 +1,153 @@
+package succession
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/glebarez/sqlite"
+	slogGorm "github.com/orandin/slog-gorm"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// SQLiteBackend stores the succession history in a SQLite database, which
+// requires the file to be shared between the old and new pods.
+type SQLiteBackend struct {
+	db         *gorm.DB
+	maxHistory int
+}
+
+// newLogger logs every query to handler at debug level, so that they are
+// only shown along with the other debug logs.  A nil handler uses the one of
+// the default logger.
+func newLogger(handler slog.Handler) gormLogger.Interface {
+	if handler == nil {
+		handler = slog.Default().Handler()
+	}
+
+	return slogGorm.New(
+		slogGorm.WithHandler(handler),
+		slogGorm.WithTraceAll(),
+		slogGorm.SetLogLevel(slogGorm.DefaultLogType, slog.LevelDebug),
+	)
+}
+
+// NewSQLiteBackend opens or creates the database at path, logging to
+// handler
+func NewSQLiteBackend(path string, handler slog.Handler) (*SQLiteBackend, error) {
+	// Open SQLite database with GORM
+	db, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=5000&_journal=WAL"), &gorm.Config{
+		Logger: newLogger(handler),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.AutoMigrate(&HistoryEntry{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return &SQLiteBackend{
+		db:         db,
+		maxHistory: MAX_HISTORY,
+	}, nil
+}
+
+// OpenSQLiteBackend opens an existing SQLite database read-only, without
+// migrating it, for inspecting the history of a running node.
+func OpenSQLiteBackend(path string, handler slog.Handler) (*SQLiteBackend, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro&_busy_timeout=5000"), &gorm.Config{
+		Logger: newLogger(handler),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &SQLiteBackend{
+		db:         db,
+		maxHistory: MAX_HISTORY,
+	}, nil
+}
+
+// SetMaxHistory sets how many entries are kept in the history, at least
+// one so that the latest claim is never trimmed
+func (b *SQLiteBackend) SetMaxHistory(n int) {
+	b.maxHistory = max(n, 1)
+}
+
+func (b *SQLiteBackend) Close() error {
+	sqlDB, err := b.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+func (b *SQLiteBackend) Claim(ctx context.Context, entry HistoryEntry) (HistoryEntry, error) {
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := gorm.G[HistoryEntry](tx).Create(ctx, &entry); err != nil {
+			return err
+		}
+
+		return b.trim(ctx, tx)
+	})
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// trim removes the oldest entries beyond the maximum history
+func (b *SQLiteBackend) trim(ctx context.Context, tx *gorm.DB) error {
+	count, err := gorm.G[HistoryEntry](tx).Count(ctx, "id")
+	if err != nil {
+		return fmt.Errorf("failed to count entries: %w", err)
+	}
+
+	if count > int64(b.maxHistory) {
+		subquery := tx.Model(&HistoryEntry{}).Select("id").Order("id DESC").Limit(b.maxHistory)
+
+		if _, err := gorm.G[HistoryEntry](tx).Where("id NOT IN (?)", subquery).Delete(ctx); err != nil {
+			return fmt.Errorf("failed to trim old entries: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *SQLiteBackend) Update(ctx context.Context, entry HistoryEntry) error {
+	return b.db.WithContext(ctx).Save(&entry).Error
+}
+
+func (b *SQLiteBackend) Current(ctx context.Context) (*HistoryEntry, error) {
+	entry, err := gorm.G[HistoryEntry](b.db).Order("id DESC").First(ctx)
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get current owner: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func (b *SQLiteBackend) WasOwner(ctx context.Context, identity string) (bool, error) {
+	count, err := gorm.G[HistoryEntry](b.db).Where("owner = ?", identity).Count(ctx, "id")
+	if err != nil {
+		return false, fmt.Errorf("failed to check ownership history: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (b *SQLiteBackend) History(ctx context.Context) ([]HistoryEntry, error) {
+	return gorm.G[HistoryEntry](b.db).Order("id DESC").Find(ctx)
+}
@@ -1,102 +1,170 @@
-// Package succession provides a file-based succession tracking mechanism
-// that maintains a history of all pods that have owned the resource.
+// Package succession provides a succession tracking mechanism that maintains
+// a history of all pods that have owned the resource.
 package succession
 
 import (
 	"context"
+	"errors"
 	"fmt"
-
-	"github.com/glebarez/sqlite"
-	slogGorm "github.com/orandin/slog-gorm"
-	"gorm.io/gorm"
+	"log/slog"
+	"sync"
+	"time"
 )
 
 const (
 	MAX_HISTORY = 25
+
+	// DEFAULT_TTL is how long a claim stays valid without being renewed
+	DEFAULT_TTL = 60 * time.Second
+)
+
+var (
+	// ErrFenced is returned when a newer claim superseded ours
+	ErrFenced = errors.New("claim superseded by a newer owner")
+
+	// ErrNotClaimed is returned when checking a token before claiming
+	ErrNotClaimed = errors.New("no claim held")
+)
+
+const (
+	OUTCOME_CLAIMED         = "claimed"
+	OUTCOME_CLEANUP_FAILED  = "cleanup_failed"
+	OUTCOME_VERSION_FAILED  = "version_failed"
+	OUTCOME_INCOMPATIBLE    = "incompatible"
+	OUTCOME_PRE_EXIT_FAILED = "pre_exit_failed"
+	OUTCOME_EXIT_FAILED     = "exit_failed"
+	OUTCOME_VERIFY_FAILED   = "verify_failed"
+	OUTCOME_DATABASE_FAILED = "database_failed"
+	OUTCOME_EXEC            = "exec"
+	OUTCOME_EXEC_FAILED     = "exec_failed"
+	OUTCOME_HOOK_FAILED     = "hook_failed"
+	OUTCOME_EXITED          = "exited"
 )
 
-// HistoryEntry represents one entry in the succession history
+// HistoryEntry represents one entry in the succession history.  Columns
+// added after the first release have defaults so older databases migrate.
 type HistoryEntry struct {
-	ID    uint   `gorm:"primarykey"`
-	Owner string `gorm:"index;not null"`
-}
+	ID    uint   `gorm:"primarykey" json:"id"`
+	Owner string `gorm:"index;not null" json:"owner"`
 
-func (h *HistoryEntry) AfterCreate(tx *gorm.DB) (err error) {
-	ctx := tx.Statement.Context
+	ClaimedAt *time.Time `json:"claimed_at,omitempty"`
+	Node      string     `gorm:"not null;default:''" json:"node,omitempty"`
+	Image     string     `gorm:"not null;default:''" json:"image,omitempty"`
 
-	count, err := gorm.G[HistoryEntry](tx).Count(ctx, "id")
-	if err != nil {
-		return fmt.Errorf("failed to count entries: %w", err)
-	}
+	// ReplacedVersion is the version of the daemon which was running when
+	// ownership was claimed
+	ReplacedVersion   string `gorm:"not null;default:''" json:"replaced_version,omitempty"`
+	HandoffDurationMs int64  `gorm:"not null;default:0" json:"handoff_duration_ms,omitempty"`
+	Outcome           string `gorm:"not null;default:''" json:"outcome,omitempty"`
 
-	if count > MAX_HISTORY {
-		subquery := tx.Model(&HistoryEntry{}).Select("id").Order("id DESC").Limit(MAX_HISTORY)
+	// ExitStatus is how the daemon exited when it was supervised
+	ExitStatus string `gorm:"not null;default:''" json:"exit_status,omitempty"`
 
-		if _, err := gorm.G[HistoryEntry](tx).Where("id NOT IN (?)", subquery).Delete(ctx); err != nil {
-			return fmt.Errorf("failed to trim old entries: %w", err)
-		}
-	}
+	// ExpiresAt is when the claim lapses unless renewed, claims without
+	// one never expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
 
-	return nil
+// Token returns the fencing token of the claim, which increases with every
+// claim.
+func (h HistoryEntry) Token() uint {
+	return h.ID
+}
+
+// Expired returns whether the claim lapsed at now
+func (h HistoryEntry) Expired(now time.Time) bool {
+	return h.ExpiresAt != nil && now.After(*h.ExpiresAt)
+}
+
+// ClaimInfo describes the pod claiming ownership
+type ClaimInfo struct {
+	Node            string
+	Image           string
+	ReplacedVersion string
+}
+
+// Backend stores the succession history, with the most recent entry being
+// the current owner.  Claim assigns the entry an ID higher than any before
+// it, which is used as the fencing token.
+type Backend interface {
+	Claim(ctx context.Context, entry HistoryEntry) (HistoryEntry, error)
+	Update(ctx context.Context, entry HistoryEntry) error
+	Current(ctx context.Context) (*HistoryEntry, error)
+	WasOwner(ctx context.Context, identity string) (bool, error)
+	History(ctx context.Context) ([]HistoryEntry, error)
+	Close() error
 }
 
 // Marker tracks succession using a history of all owners
 type Marker struct {
-	db       *gorm.DB
+	backend  Backend
 	identity string
-}
+	ttl      time.Duration
+	token    uint
 
-// New creates a new succession marker with history tracking
-func New(path, identity string) (*Marker, error) {
-	gormLogger := slogGorm.New()
+	// mu serializes updates of our claim
+	mu sync.Mutex
+}
 
-	// Open SQLite database with GORM
-	db, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=5000&_journal=WAL"), &gorm.Config{
-		Logger: gormLogger,
-	})
+// New creates a new succession marker with history tracking in a SQLite
+// database at path, logging queries to handler
+func New(path, identity string, handler slog.Handler) (*Marker, error) {
+	backend, err := NewSQLiteBackend(path, handler)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	if err := db.AutoMigrate(&HistoryEntry{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate schema: %w", err)
-	}
+	return NewWithBackend(backend, identity), nil
+}
 
+// NewWithBackend creates a new succession marker using backend
+func NewWithBackend(backend Backend, identity string) *Marker {
 	return &Marker{
-		db:       db,
+		backend:  backend,
 		identity: identity,
-	}, nil
+		ttl:      DEFAULT_TTL,
+	}
 }
 
-func (m *Marker) Close() error {
-	sqlDB, err := m.db.DB()
-	if err != nil {
-		return err
-	}
+// SetTTL sets how long claims stay valid without being renewed, 0 makes
+// them never expire.
+func (m *Marker) SetTTL(ttl time.Duration) {
+	m.ttl = ttl
+}
 
-	return sqlDB.Close()
+// Token returns the fencing token of our claim, 0 if we did not claim.
+func (m *Marker) Token() uint {
+	return m.token
 }
 
-func (m *Marker) WasOwner(ctx context.Context) (bool, error) {
-	count, err := gorm.G[HistoryEntry](m.db).Where("owner = ?", m.identity).Count(ctx, "id")
-	if err != nil {
-		return false, fmt.Errorf("failed to check ownership history: %w", err)
-	}
+func (m *Marker) Close() error {
+	return m.backend.Close()
+}
 
-	return count > 0, nil
+func (m *Marker) WasOwner(ctx context.Context) (bool, error) {
+	return m.backend.WasOwner(ctx, m.identity)
 }
 
 // CheckSuccession determines if this pod should proceed
 // Returns: shouldProceed, isReplaced, error
 func (m *Marker) CheckSuccession(ctx context.Context) (bool, bool, error) {
-	// Get the current owner (most recent entry)
-	currentOwner, err := m.CurrentOwner(ctx)
+	// Get the current claim (most recent entry)
+	current, err := m.backend.Current(ctx)
 	if err != nil {
 		return false, false, err
 	}
 
 	// We're the current owner (or first) - proceed
-	if currentOwner == "" || currentOwner == m.identity {
+	if current == nil || current.Owner == m.identity {
+		return true, false, nil
+	}
+
+	// The current owner never finished the handoff, take over
+	if current.Expired(time.Now()) {
+		slog.Info("taking over lapsed claim",
+			"owner", current.Owner,
+			"token", current.Token(),
+			"expired_at", current.ExpiresAt)
 		return true, false, nil
 	}
 
@@ -114,21 +182,190 @@ func (m *Marker) CheckSuccession(ctx context.Context) (bool, bool, error) {
 }
 
 func (m *Marker) Claim(ctx context.Context) error {
-	return gorm.G[HistoryEntry](m.db).Create(ctx, &HistoryEntry{Owner: m.identity})
+	return m.ClaimWithInfo(ctx, ClaimInfo{})
+}
+
+func (m *Marker) ClaimWithInfo(ctx context.Context, info ClaimInfo) error {
+	now := time.Now().UTC()
+
+	entry, err := m.backend.Claim(ctx, HistoryEntry{
+		Owner:           m.identity,
+		ClaimedAt:       &now,
+		Node:            info.Node,
+		Image:           info.Image,
+		ReplacedVersion: info.ReplacedVersion,
+		Outcome:         OUTCOME_CLAIMED,
+		ExpiresAt:       m.expiry(now),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.token = entry.Token()
+	return nil
+}
+
+func (m *Marker) expiry(now time.Time) *time.Time {
+	if m.ttl <= 0 {
+		return nil
+	}
+
+	expiresAt := now.Add(m.ttl)
+	return &expiresAt
+}
+
+// current returns our claim if it is still the current one
+func (m *Marker) current(ctx context.Context) (*HistoryEntry, error) {
+	if m.token == 0 {
+		return nil, ErrNotClaimed
+	}
+
+	current, err := m.backend.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil || current.Token() != m.token {
+		owner := ""
+		if current != nil {
+			owner = current.Owner
+		}
+		return nil, fmt.Errorf("%w: token %d is no longer current, owner is %q", ErrFenced, m.token, owner)
+	}
+
+	return current, nil
+}
+
+// Resume adopts the current claim when we own it, such as when another
+// process of the pod made it, so that Validate fences what follows.  It
+// fails with ErrNotClaimed when someone else owns the current claim.
+func (m *Marker) Resume(ctx context.Context) error {
+	current, err := m.backend.Current(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.Owner != m.identity {
+		return ErrNotClaimed
+	}
+
+	m.token = current.Token()
+	return nil
+}
+
+// Validate checks that our claim is still the current one, it must be
+// called before doing anything destructive on behalf of the claim.
+func (m *Marker) Validate(ctx context.Context) error {
+	_, err := m.current(ctx)
+	return err
+}
+
+// Renew extends the expiry of our claim, failing with ErrFenced if it was
+// superseded.
+func (m *Marker) Renew(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.current(ctx)
+	if err != nil {
+		return err
+	}
+
+	if entry.ExpiresAt == nil {
+		return nil
+	}
+
+	entry.ExpiresAt = m.expiry(time.Now().UTC())
+	return m.backend.Update(ctx, *entry)
+}
+
+// KeepAlive renews our claim periodically until ctx is done or the claim
+// is superseded.
+func (m *Marker) KeepAlive(ctx context.Context) error {
+	if m.ttl <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := m.Renew(ctx)
+			switch {
+			case errors.Is(err, ErrFenced), errors.Is(err, ErrNotClaimed):
+				return err
+			case err != nil && ctx.Err() == nil:
+				slog.Warn("failed to renew claim", "token", m.token, "error", err)
+			}
+		}
+	}
+}
+
+// RecordOutcome updates our claim with the outcome of the handoff and how
+// long it took, failing with ErrNotClaimed before claiming since the earlier
+// claims of the same owner are not ours to update.  Once the process is
+// executed nothing is left to renew the claim, so it no longer expires.
+func (m *Marker) RecordOutcome(ctx context.Context, outcome string, duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == 0 {
+		return ErrNotClaimed
+	}
+
+	history, err := m.GetHistory(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range history {
+		if entry.Token() != m.token || entry.Owner != m.identity {
+			continue
+		}
+
+		entry.Outcome = outcome
+		entry.HandoffDurationMs = duration.Milliseconds()
+		if outcome == OUTCOME_EXEC {
+			entry.ExpiresAt = nil
+		}
+
+		return m.backend.Update(ctx, entry)
+	}
+
+	return fmt.Errorf("no claim found for %s", m.identity)
+}
+
+// RecordExit updates our claim with how the supervised daemon exited,
+// failing with ErrFenced if the claim was superseded since the daemon then
+// belongs to the new owner.
+func (m *Marker) RecordExit(ctx context.Context, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.current(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry.Outcome = OUTCOME_EXITED
+	entry.ExitStatus = status
+	return m.backend.Update(ctx, *entry)
 }
 
 func (m *Marker) CurrentOwner(ctx context.Context) (string, error) {
-	entry, err := gorm.G[HistoryEntry](m.db).Order("id DESC").First(ctx)
-	switch {
-	case err == gorm.ErrRecordNotFound:
-		return "", nil
-	case err != nil:
-		return "", fmt.Errorf("failed to get current owner: %w", err)
+	current, err := m.backend.Current(ctx)
+	if err != nil || current == nil {
+		return "", err
 	}
 
-	return entry.Owner, nil
+	return current.Owner, nil
 }
 
 func (m *Marker) GetHistory(ctx context.Context) ([]HistoryEntry, error) {
-	return gorm.G[HistoryEntry](m.db).Order("id DESC").Find(ctx)
+	return m.backend.History(ctx)
 }
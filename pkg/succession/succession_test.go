@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func createMarker(t *testing.T, dir, podName string) *Marker {
@@ -14,7 +17,7 @@ func createMarker(t *testing.T, dir, podName string) *Marker {
 
 	dbPath := filepath.Join(dir, "test.db")
 
-	marker, err := New(dbPath, podName)
+	marker, err := New(dbPath, podName, nil)
 	require.NoError(t, err)
 
 	return marker
@@ -267,3 +270,339 @@ func TestMultiplePodRotations(t *testing.T) {
 	assert.Equal(t, "pod-b", history[1].Owner)
 	assert.Equal(t, "pod-a", history[2].Owner)
 }
+
+func TestClaimWithInfo(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	marker := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := marker.Close(); err != nil {
+			t.Errorf("failed to close marker: %v", err)
+		}
+	}()
+
+	err := marker.ClaimWithInfo(ctx, ClaimInfo{
+		Node:            "node-1",
+		Image:           "ghcr.io/vexxhost/openvswitch:3.5.0",
+		ReplacedVersion: "ovs-vswitchd (Open vSwitch) 3.4.0",
+	})
+	require.NoError(t, err)
+
+	err = marker.RecordOutcome(ctx, OUTCOME_EXEC, 1500*time.Millisecond)
+	require.NoError(t, err)
+
+	history, err := marker.GetHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	entry := history[0]
+	assert.Equal(t, "pod-1", entry.Owner)
+	assert.Equal(t, "node-1", entry.Node)
+	assert.Equal(t, "ghcr.io/vexxhost/openvswitch:3.5.0", entry.Image)
+	assert.Equal(t, "ovs-vswitchd (Open vSwitch) 3.4.0", entry.ReplacedVersion)
+	assert.Equal(t, int64(1500), entry.HandoffDurationMs)
+	assert.Equal(t, OUTCOME_EXEC, entry.Outcome)
+	require.NotNil(t, entry.ClaimedAt)
+	assert.WithinDuration(t, time.Now(), *entry.ClaimedAt, time.Minute)
+}
+
+func TestRecordOutcomeWithoutClaim(t *testing.T) {
+	marker := createMarker(t, t.TempDir(), "pod-1")
+	defer func() {
+		if err := marker.Close(); err != nil {
+			t.Errorf("failed to close marker: %v", err)
+		}
+	}()
+
+	err := marker.RecordOutcome(t.Context(), OUTCOME_EXEC, time.Second)
+	assert.ErrorIs(t, err, ErrNotClaimed)
+}
+
+func TestRecordOutcomeEarlierClaim(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	pod1 := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := pod1.Close(); err != nil {
+			t.Errorf("failed to close marker: %v", err)
+		}
+	}()
+	require.NoError(t, pod1.Claim(ctx))
+	require.NoError(t, pod1.RecordOutcome(ctx, OUTCOME_EXEC, time.Second))
+
+	// The same pod restarting without claiming again must not overwrite
+	// the outcome of its earlier claim
+	restarted := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := restarted.Close(); err != nil {
+			t.Errorf("failed to close marker: %v", err)
+		}
+	}()
+	assert.ErrorIs(t, restarted.RecordOutcome(ctx, OUTCOME_HOOK_FAILED, time.Second), ErrNotClaimed)
+
+	history, err := pod1.GetHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, OUTCOME_EXEC, history[0].Outcome)
+}
+
+func TestRecordExit(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	pod1 := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := pod1.Close(); err != nil {
+			t.Errorf("failed to close marker: %v", err)
+		}
+	}()
+
+	require.NoError(t, pod1.Claim(ctx))
+	require.NoError(t, pod1.RecordOutcome(ctx, OUTCOME_EXEC, time.Second))
+	require.NoError(t, pod1.RecordExit(ctx, "exit status 1"))
+
+	history, err := pod1.GetHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, OUTCOME_EXITED, history[0].Outcome)
+	assert.Equal(t, "exit status 1", history[0].ExitStatus)
+	assert.Equal(t, int64(1000), history[0].HandoffDurationMs)
+
+	pod2 := createMarker(t, dir, "pod-2")
+	defer func() {
+		if err := pod2.Close(); err != nil {
+			t.Errorf("failed to close marker: %v", err)
+		}
+	}()
+	require.NoError(t, pod2.Claim(ctx))
+
+	// The daemon of a superseded claim belongs to the new owner
+	assert.ErrorIs(t, pod1.RecordExit(ctx, "exit status 0"), ErrFenced)
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	// Databases created before the history entries were extended only have
+	// the id and owner columns
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE history_entries (id integer PRIMARY KEY AUTOINCREMENT, owner text NOT NULL)").Error)
+	require.NoError(t, db.Exec("INSERT INTO history_entries (owner) VALUES ('pod-1'), ('pod-2')").Error)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	marker := createMarker(t, dir, "pod-3")
+	defer func() {
+		if err := marker.Close(); err != nil {
+			t.Errorf("failed to close marker: %v", err)
+		}
+	}()
+
+	history, err := marker.GetHistory(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "pod-2", history[0].Owner)
+	assert.Nil(t, history[0].ClaimedAt)
+	assert.Empty(t, history[0].Outcome)
+
+	require.NoError(t, marker.Claim(ctx))
+
+	owner, err := marker.CurrentOwner(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "pod-3", owner)
+}
+
+func TestOpenSQLiteBackend(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	_, err := OpenSQLiteBackend(filepath.Join(dir, "missing.db"), nil)
+	assert.Error(t, err)
+
+	marker := createMarker(t, dir, "pod-1")
+	require.NoError(t, marker.Claim(ctx))
+	require.NoError(t, marker.Close())
+
+	backend, err := OpenSQLiteBackend(filepath.Join(dir, "test.db"), nil)
+	require.NoError(t, err)
+	defer func() {
+		if err := backend.Close(); err != nil {
+			t.Errorf("failed to close backend: %v", err)
+		}
+	}()
+
+	history, err := backend.History(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "pod-1", history[0].Owner)
+
+	_, err = backend.Claim(ctx, HistoryEntry{Owner: "pod-2"})
+	assert.Error(t, err, "read-only backend must not accept claims")
+}
+
+func TestFencingToken(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	pod1 := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := pod1.Close(); err != nil {
+			t.Errorf("failed to close pod1: %v", err)
+		}
+	}()
+
+	assert.ErrorIs(t, pod1.Validate(ctx), ErrNotClaimed)
+
+	require.NoError(t, pod1.Claim(ctx))
+	require.NoError(t, pod1.Validate(ctx))
+	require.NoError(t, pod1.Renew(ctx))
+
+	pod2 := createMarker(t, dir, "pod-2")
+	defer func() {
+		if err := pod2.Close(); err != nil {
+			t.Errorf("failed to close pod2: %v", err)
+		}
+	}()
+
+	require.NoError(t, pod2.Claim(ctx))
+	assert.Greater(t, pod2.Token(), pod1.Token())
+	require.NoError(t, pod2.Validate(ctx))
+
+	assert.ErrorIs(t, pod1.Validate(ctx), ErrFenced)
+	assert.ErrorIs(t, pod1.Renew(ctx), ErrFenced)
+
+	pod1.SetTTL(30 * time.Millisecond)
+	assert.ErrorIs(t, pod1.KeepAlive(ctx), ErrFenced)
+}
+
+func TestResume(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	pod1 := createMarker(t, dir, "pod-1")
+	require.NoError(t, pod1.Claim(ctx))
+	require.NoError(t, pod1.Close())
+
+	// Another process of the same pod picks up the claim
+	resumed := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := resumed.Close(); err != nil {
+			t.Errorf("failed to close resumed: %v", err)
+		}
+	}()
+
+	require.NoError(t, resumed.Resume(ctx))
+	require.NoError(t, resumed.Validate(ctx))
+
+	pod2 := createMarker(t, dir, "pod-2")
+	defer func() {
+		if err := pod2.Close(); err != nil {
+			t.Errorf("failed to close pod2: %v", err)
+		}
+	}()
+
+	assert.ErrorIs(t, pod2.Resume(ctx), ErrNotClaimed)
+	require.NoError(t, pod2.Claim(ctx))
+
+	assert.ErrorIs(t, resumed.Validate(ctx), ErrFenced)
+}
+
+func TestLapsedClaimTakeover(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	pod1 := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := pod1.Close(); err != nil {
+			t.Errorf("failed to close pod1: %v", err)
+		}
+	}()
+
+	require.NoError(t, pod1.Claim(ctx))
+	require.NoError(t, pod1.RecordOutcome(ctx, OUTCOME_EXEC, time.Second))
+
+	history, err := pod1.GetHistory(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, history[0].ExpiresAt, "executed claims must not expire")
+
+	// pod-2 crashes before executing, so its claim is never renewed
+	pod2 := createMarker(t, dir, "pod-2")
+	defer func() {
+		if err := pod2.Close(); err != nil {
+			t.Errorf("failed to close pod2: %v", err)
+		}
+	}()
+	pod2.SetTTL(10 * time.Millisecond)
+
+	require.NoError(t, pod2.Claim(ctx))
+
+	shouldProceed, isReplaced, err := pod1.CheckSuccession(ctx)
+	require.NoError(t, err)
+	assert.False(t, shouldProceed)
+	assert.True(t, isReplaced)
+
+	time.Sleep(20 * time.Millisecond)
+
+	shouldProceed, isReplaced, err = pod1.CheckSuccession(ctx)
+	require.NoError(t, err)
+	assert.True(t, shouldProceed)
+	assert.False(t, isReplaced)
+
+	require.NoError(t, pod1.Claim(ctx))
+	require.NoError(t, pod1.Validate(ctx))
+	assert.ErrorIs(t, pod2.Validate(ctx), ErrFenced)
+}
+
+func TestRenewExtendsClaim(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	pod1 := createMarker(t, dir, "pod-1")
+	defer func() {
+		if err := pod1.Close(); err != nil {
+			t.Errorf("failed to close pod1: %v", err)
+		}
+	}()
+	pod1.SetTTL(time.Hour)
+
+	require.NoError(t, pod1.Claim(ctx))
+
+	history, err := pod1.GetHistory(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, history[0].ExpiresAt)
+	claimedExpiry := *history[0].ExpiresAt
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, pod1.Renew(ctx))
+
+	history, err = pod1.GetHistory(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, history[0].ExpiresAt)
+	assert.True(t, history[0].ExpiresAt.After(claimedExpiry))
+}
+
+func TestSetMaxHistory(t *testing.T) {
+	ctx := t.Context()
+
+	backend, err := NewSQLiteBackend(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	backend.SetMaxHistory(3)
+
+	for i := 0; i < 5; i++ {
+		marker := NewWithBackend(backend, fmt.Sprintf("pod-%d", i))
+		require.NoError(t, marker.Claim(ctx))
+	}
+
+	history, err := backend.History(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, "pod-4", history[0].Owner)
+	assert.Equal(t, "pod-2", history[2].Owner)
+	assert.NoError(t, backend.Close())
+}
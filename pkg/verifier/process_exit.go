@@ -0,0 +1,183 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
+)
+
+type ProcessExitVerifier struct {
+	pid       int
+	pidfd     int
+	startTime uint64
+	fs        *procfs.FS
+}
+
+// ProcessExit waits for pid to exit.  Since the pid may be reused once the
+// process exited, ProcessExitFd or ProcessExitStarted are preferred when
+// the process was asked to exit beforehand.
+func ProcessExit(pid int) *ProcessExitVerifier {
+	return &ProcessExitVerifier{
+		pid:   pid,
+		pidfd: -1,
+	}
+}
+
+// ProcessExitFd waits on pidfd, opened on the process running as pid before
+// it was asked to exit.  The pidfd remains owned by the caller.
+func ProcessExitFd(pid, pidfd int) *ProcessExitVerifier {
+	return &ProcessExitVerifier{
+		pid:   pid,
+		pidfd: pidfd,
+	}
+}
+
+// ProcessExitStarted polls procfs for the process running as pid with the
+// given start time, read before it was asked to exit, for kernels without
+// pidfds.
+func ProcessExitStarted(pid int, startTime uint64) *ProcessExitVerifier {
+	return &ProcessExitVerifier{
+		pid:       pid,
+		pidfd:     -1,
+		startTime: startTime,
+	}
+}
+
+// ProcessExitWithFS polls fs for the process to disappear instead of
+// waiting on a pidfd.
+func ProcessExitWithFS(pid int, fs *procfs.FS) *ProcessExitVerifier {
+	return &ProcessExitVerifier{
+		pid:   pid,
+		pidfd: -1,
+		fs:    fs,
+	}
+}
+
+func (v *ProcessExitVerifier) String() string {
+	return fmt.Sprintf("process_exit(%d)", v.pid)
+}
+
+func (v *ProcessExitVerifier) Verify(ctx context.Context) error {
+	if v.pidfd >= 0 {
+		return v.waitPidfd(ctx, v.pidfd)
+	}
+
+	if v.fs == nil && v.startTime == 0 {
+		pidfd, err := unix.PidfdOpen(v.pid, 0)
+		switch {
+		case errors.Is(err, unix.ESRCH):
+			slog.Info(fmt.Sprintf("%s: process already exited", v.String()))
+			return nil
+		case err == nil:
+			defer func() {
+				_ = unix.Close(pidfd)
+			}()
+
+			return v.waitPidfd(ctx, pidfd)
+		}
+
+		slog.Debug("pidfd not available, polling procfs", "error", err)
+	}
+
+	if v.fs == nil {
+		fs, err := procfs.NewDefaultFS()
+		if err != nil {
+			return fmt.Errorf("failed to open procfs: %w", err)
+		}
+
+		v.fs = &fs
+	}
+
+	return v.pollProcFS(ctx)
+}
+
+// waitPidfd waits for the pidfd to become readable, which happens once the
+// process exited, blocking in poll along with an eventfd which is signalled
+// once ctx is done.
+func (v *ProcessExitVerifier) waitPidfd(ctx context.Context, pidfd int) error {
+	wake, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("failed to create eventfd: %w", err)
+	}
+
+	signalled := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(signalled)
+		_, _ = unix.Write(wake, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	})
+	defer func() {
+		// The eventfd must outlive a signal already under way
+		if !stop() {
+			<-signalled
+		}
+		_ = unix.Close(wake)
+	}()
+
+	fds := []unix.PollFd{
+		{Fd: int32(pidfd), Events: unix.POLLIN},
+		{Fd: int32(wake), Events: unix.POLLIN},
+	}
+
+	for {
+		_, err := unix.Poll(fds, -1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to poll pidfd: %w", err)
+		}
+
+		if fds[0].Revents != 0 {
+			slog.Info(fmt.Sprintf("%s: process exited", v.String()))
+			return nil
+		}
+
+		if fds[1].Revents != 0 {
+			return fmt.Errorf("timeout waiting for %s: %w", v.String(), ctx.Err())
+		}
+	}
+}
+
+// pollProcFS waits for the process to disappear from procfs, treating a
+// different start time as the PID having been reused.  Without a known
+// start time, the one seen first is used.
+func (v *ProcessExitVerifier) pollProcFS(ctx context.Context) error {
+	startTime := v.startTime
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		proc, err := v.fs.Proc(v.pid)
+		if err == nil {
+			var stat procfs.ProcStat
+			stat, err = proc.Stat()
+			if err == nil {
+				if startTime == 0 {
+					startTime = stat.Starttime
+				}
+
+				if stat.Starttime != startTime {
+					slog.Info(fmt.Sprintf("%s: process exited, pid reused", v.String()))
+					return nil
+				}
+			}
+		}
+
+		if err != nil {
+			slog.Info(fmt.Sprintf("%s: process exited", v.String()))
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for %s: %w", v.String(), ctx.Err())
+		}
+	}
+}
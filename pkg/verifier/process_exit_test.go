@@ -0,0 +1,149 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/procfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func createProcStat(t *testing.T, dir string, pid int, startTime uint64) {
+	t.Helper()
+
+	pidDir := filepath.Join(dir, fmt.Sprint(pid))
+	require.NoError(t, os.MkdirAll(pidDir, 0755))
+
+	content := fmt.Sprintf("%d (ovs-vswitchd) S 1 %d %d 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 %d 1000 100 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+		pid, pid, pid, startTime)
+	require.NoError(t, os.WriteFile(filepath.Join(pidDir, "stat"), []byte(content), 0644))
+}
+
+func createProcFS(t *testing.T) (*procfs.FS, string) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	fs, err := procfs.NewFS(tempDir)
+	require.NoError(t, err)
+
+	return &fs, tempDir
+}
+
+func TestProcessExitVerifier(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	err := ProcessExit(cmd.Process.Pid).Verify(t.Context())
+	assert.NoError(t, err)
+}
+
+func TestProcessExitVerifier_AlreadyExited(t *testing.T) {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+
+	err := ProcessExit(cmd.Process.Pid).Verify(t.Context())
+	assert.NoError(t, err)
+}
+
+func TestProcessExitVerifier_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	err := ProcessExit(os.Getpid()).Verify(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestProcessExitVerifier_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := ProcessExit(os.Getpid()).Verify(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestProcessExitVerifier_Fd(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, cmd.Start())
+
+	pidfd, err := unix.PidfdOpen(cmd.Process.Pid, 0)
+	if errors.Is(err, unix.ENOSYS) {
+		t.Skip("pidfd not supported")
+	}
+	require.NoError(t, err)
+	defer func() {
+		_ = unix.Close(pidfd)
+	}()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	err = ProcessExitFd(cmd.Process.Pid, pidfd).Verify(t.Context())
+	assert.NoError(t, err)
+}
+
+func TestProcessExitVerifier_ProcFS(t *testing.T) {
+	fs, tempDir := createProcFS(t)
+	createProcStat(t, tempDir, 1234, 100)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.RemoveAll(filepath.Join(tempDir, "1234"))
+	}()
+
+	err := ProcessExitWithFS(1234, fs).Verify(t.Context())
+	assert.NoError(t, err)
+}
+
+func TestProcessExitVerifier_ProcFSReusedPid(t *testing.T) {
+	fs, tempDir := createProcFS(t)
+	createProcStat(t, tempDir, 1234, 100)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		createProcStat(t, tempDir, 1234, 200)
+	}()
+
+	err := ProcessExitWithFS(1234, fs).Verify(t.Context())
+	assert.NoError(t, err)
+}
+
+func TestProcessExitVerifier_ProcFSReusedBeforeVerify(t *testing.T) {
+	fs, tempDir := createProcFS(t)
+
+	// The pid was already reused when verification starts
+	createProcStat(t, tempDir, 1234, 200)
+
+	v := ProcessExitStarted(1234, 100)
+	v.fs = fs
+
+	err := v.Verify(t.Context())
+	assert.NoError(t, err)
+}
+
+func TestProcessExitVerifier_ProcFSTimeout(t *testing.T) {
+	fs, tempDir := createProcFS(t)
+	createProcStat(t, tempDir, 1234, 100)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	err := ProcessExitWithFS(1234, fs).Verify(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -13,14 +14,38 @@ type Verifier interface {
 	Verify(ctx context.Context) error
 }
 
+// Result is the outcome of a verifier and how long it took
+type Result struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+	Err   error
+}
+
 func Run(ctx context.Context, verifiers ...Verifier) error {
+	_, err := RunWithResults(ctx, verifiers...)
+	return err
+}
+
+// RunWithResults runs the verifiers like Run and returns their results in
+// the order they were given.
+func RunWithResults(ctx context.Context, verifiers ...Verifier) ([]Result, error) {
 	g, ctx := errgroup.WithContext(ctx)
 
-	for _, v := range verifiers {
+	results := make([]Result, len(verifiers))
+	for i, v := range verifiers {
 		g.Go(func() error {
 			slog.Debug("starting verifier", "name", v.String())
 
+			start := time.Now()
 			err := v.Verify(ctx)
+			results[i] = Result{
+				Name:  v.String(),
+				Start: start,
+				End:   time.Now(),
+				Err:   err,
+			}
+
 			if err != nil {
 				slog.Error("verifier failed", "name", v.String(), "error", err)
 				return fmt.Errorf("%s: %w", v.String(), err)
@@ -32,8 +57,8 @@ func Run(ctx context.Context, verifiers ...Verifier) error {
 	}
 
 	if err := g.Wait(); err != nil {
-		return fmt.Errorf("verification failed: %w", err)
+		return results, fmt.Errorf("verification failed: %w", err)
 	}
 
-	return nil
+	return results, nil
 }
@@ -119,3 +119,19 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRunWithResults(t *testing.T) {
+	results, err := RunWithResults(context.Background(),
+		&mockVerifier{name: "slow", delay: 20 * time.Millisecond},
+		&mockVerifier{name: "failing", shouldFail: true},
+	)
+	assert.Error(t, err)
+	assert.Len(t, results, 2)
+
+	assert.Equal(t, "slow", results[0].Name)
+	assert.ErrorIs(t, results[0].Err, context.Canceled)
+
+	assert.Equal(t, "failing", results[1].Name)
+	assert.ErrorIs(t, results[1].Err, assert.AnError)
+	assert.False(t, results[1].End.Before(results[1].Start))
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+	"github.com/vexxhost/ovsinit/pkg/hooks"
+	"github.com/vexxhost/ovsinit/pkg/ovsdb"
+	"github.com/vexxhost/ovsinit/pkg/ovsdbtool"
+)
+
+// plan is the sequence of actions a handoff would take
+type plan struct {
+	steps []string
+}
+
+func (p *plan) add(format string, args ...any) {
+	p.steps = append(p.steps, fmt.Sprintf(format, args...))
+}
+
+func (p *plan) addHooks(hs *hooks.Hooks, phase string) {
+	for _, entry := range hs.Entries(phase) {
+		policy := hooks.POLICY_FAIL_CLOSED
+		if entry.FailOpen {
+			policy = hooks.POLICY_FAIL_OPEN
+		}
+
+		p.add("run %s hook %s (%s)", phase, entry.String(), policy)
+	}
+}
+
+func (p *plan) write(w io.Writer) error {
+	for i, step := range p.steps {
+		if _, err := fmt.Fprintf(w, "%d. %s\n", i+1, step); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dryRun runs the read-only steps of the handoff and prints the plan it
+// would execute, without claiming the succession, stopping the existing
+// daemon, converting the database or starting the new one.
+func (h *handoff) dryRun(ctx context.Context, binaryPath string, processArgs []string, db *databaseOptions) int {
+	var p plan
+
+	err := h.planHandoff(ctx, &p, binaryPath, processArgs, db)
+	if writeErr := p.write(os.Stdout); writeErr != nil {
+		slog.Error("failed to write plan", "error", writeErr)
+		return 1
+	}
+
+	if err != nil {
+		slog.Error("handoff would fail", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+func (h *handoff) planHandoff(ctx context.Context, p *plan, binaryPath string, processArgs []string, db *databaseOptions) error {
+	proceed, err := h.planSuccession(ctx, p)
+	if err != nil || !proceed {
+		return err
+	}
+
+	if incoming, err := binaryVersion(ctx, binaryPath); err != nil {
+		slog.Warn("failed to get version of new process", "error", err)
+	} else {
+		h.incomingVersion = incoming.Version
+	}
+
+	client, err := dialDaemon(h.profile, h.runDir)
+	switch {
+	case errors.Is(err, appctl.ErrNoPidFile):
+		p.addHooks(&h.hooks, hooks.PHASE_PRE_CLAIM)
+		p.add("claim succession as %s, no existing process found", h.pod)
+	case errors.Is(err, appctl.ErrUnreachable):
+		return fmt.Errorf("existing process is running but unreachable: %w", err)
+	case errors.Is(err, appctl.ErrPidNamespace):
+		return fmt.Errorf("existing process is not visible, the pod needs hostPID or to share the process namespace of the daemon: %w", err)
+	case errors.Is(err, appctl.ErrStalePidFile):
+		p.add("clean up the files of the existing process, which is not running")
+		p.addHooks(&h.hooks, hooks.PHASE_PRE_CLAIM)
+		p.add("claim succession as %s", h.pod)
+	case err != nil:
+		return fmt.Errorf("failed to find existing process: %w", err)
+	default:
+		defer func() {
+			if err := client.Close(); err != nil {
+				slog.Warn("failed to close client", "error", err)
+			}
+		}()
+
+		version, err := client.Version(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get version: %w", err)
+		}
+		h.replacedVersion = version.Version
+
+		if err := h.checkCompatibility(ctx, db); err != nil {
+			p.add("refuse replacing %s with %s: %v", version.Version, h.incomingVersion, err)
+			return err
+		}
+		p.add("allow replacing %s with %s", version.Version, h.incomingVersion)
+
+		p.addHooks(&h.hooks, hooks.PHASE_PRE_CLAIM)
+		p.add("claim succession as %s, replacing %s", h.pod, version.Version)
+		p.addHooks(&h.hooks, hooks.PHASE_PRE_EXIT)
+		for _, s := range h.profile.preExit {
+			p.add("run pre-exit step %s", s.name)
+		}
+
+		p.add("ask the existing process (pid %d) to exit with %q", client.Process.Pid,
+			strings.Join(append([]string{h.profile.exitCommand}, h.profile.exitArgs...), " "))
+
+		for _, v := range h.profile.exitVerifiers(h.runDir, client.Process) {
+			p.add("verify %s", v.String())
+		}
+
+		p.addHooks(&h.hooks, hooks.PHASE_POST_EXIT)
+	}
+
+	if db.path != "" {
+		if err := planDatabase(ctx, p, db); err != nil {
+			return err
+		}
+	}
+
+	p.addHooks(&h.hooks, hooks.PHASE_PRE_EXEC)
+
+	command := strings.Join(append([]string{binaryPath}, processArgs...), " ")
+	if h.incomingVersion != "" {
+		command = fmt.Sprintf("%s (%s)", command, h.incomingVersion)
+	}
+
+	if *superviseFlag {
+		p.add("start and supervise %s", command)
+	} else {
+		p.add("exec %s", command)
+	}
+
+	return nil
+}
+
+// planSuccession checks whether the handoff would proceed, like the real
+// one, without creating the succession database if it does not exist.
+func (h *handoff) planSuccession(ctx context.Context, p *plan) (bool, error) {
+	marker, err := openSuccessionMarker(*successionBackend, h.runDir, h.profile.name, h.pod, slog.Default().Handler())
+	if errors.Is(err, fs.ErrNotExist) {
+		p.add("proceed, no succession history")
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open succession marker: %w", err)
+	}
+	defer func() {
+		if err := marker.Close(); err != nil {
+			slog.Warn("failed to close marker", "error", err)
+		}
+	}()
+
+	shouldProceed, wasReplaced, err := marker.CheckSuccession(ctx)
+	if err != nil {
+		slog.Warn("failed to check succession", "error", err)
+		shouldProceed = true
+	}
+
+	currentOwner, _ := marker.CurrentOwner(ctx)
+	switch {
+	case wasReplaced:
+		p.add("exit, replaced by %s", currentOwner)
+		return false, nil
+	case !shouldProceed:
+		return false, errors.New("succession check says we shouldn't proceed")
+	case currentOwner == "":
+		p.add("proceed, no current owner")
+	default:
+		p.add("proceed, current owner is %s", currentOwner)
+	}
+
+	return true, nil
+}
+
+// planDatabase describes how the database would be created or converted
+func planDatabase(ctx context.Context, p *plan, db *databaseOptions) error {
+	if _, err := os.Stat(db.path); os.IsNotExist(err) {
+		switch {
+		case db.clusterLocal == "":
+			p.add("create database %s", db.path)
+		case len(db.clusterRemotes) == 0:
+			p.add("create clustered database %s as %s", db.path, db.clusterLocal)
+		default:
+			p.add("join clustered database %s as %s through %s", db.path, db.clusterLocal, strings.Join(db.clusterRemotes, ","))
+		}
+
+		return nil
+	}
+
+	if db.schema == "" {
+		return nil
+	}
+
+	schema, err := ovsdbtool.ReadSchema(db.schema)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	clustered, err := ovsdbtool.IsClustered(db.path)
+	if err != nil {
+		return fmt.Errorf("failed to check if database is clustered: %w", err)
+	}
+
+	if clustered {
+		return planClusteredDatabase(ctx, p, db, schema)
+	}
+
+	needsConversion, err := ovsdbtool.NeedsConversion(db.path, db.schema)
+	if err != nil {
+		return fmt.Errorf("failed to check if database needs conversion: %w", err)
+	}
+
+	if !needsConversion {
+		p.add("keep database %s, already at schema %s", db.path, schema.Version)
+		return nil
+	}
+
+	dbVersion, err := ovsdbtool.DbVersion(db.path)
+	if err != nil {
+		return fmt.Errorf("failed to get database version: %w", err)
+	}
+
+	if db.backups > 0 {
+		p.add("back up database %s", db.path)
+	}
+
+	if db.restoreBackup && ovsdbtool.CompareVersions(schema.Version, dbVersion) < 0 {
+		p.add("restore the backup of database %s for schema %s if there is one", db.path, schema.Version)
+	}
+
+	p.add("convert database %s from schema %s to %s", db.path, dbVersion, schema.Version)
+
+	if db.backups > 0 {
+		p.add("prune the backups of database %s once converted, keeping %d", db.path, db.backups)
+	}
+
+	return nil
+}
+
+func planClusteredDatabase(ctx context.Context, p *plan, db *databaseOptions, schema *ovsdb.Schema) error {
+	if len(db.endpoints) == 0 {
+		return fmt.Errorf("converting clustered database %s requires -ovs-db-endpoints", db.path)
+	}
+
+	header, err := ovsdbtool.ReadClusterHeader(db.path)
+	if err != nil {
+		return err
+	}
+
+	client, err := ovsdb.DialLeader(ctx, db.endpoints, header.Name, db.tlsConfig)
+	if errors.Is(err, ovsdb.ErrInvalidEndpoint) {
+		return err
+	}
+	if err != nil {
+		p.add("skip conversion of clustered database %s, no cluster leader found", header.Name)
+		return nil
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Warn("failed to close database client", "error", err)
+		}
+	}()
+
+	current, err := client.GetSchema(ctx, header.Name)
+	if err != nil {
+		return err
+	}
+
+	if ovsdbtool.SchemaEqual(current, schema) {
+		p.add("keep clustered database %s, already at schema %s", header.Name, schema.Version)
+		return nil
+	}
+
+	if ovsdbtool.CompareVersions(schema.Version, current.Version) <= 0 {
+		p.add("keep clustered database %s at schema %s, not older than schema %s", header.Name, current.Version, schema.Version)
+		return nil
+	}
+
+	p.add("convert clustered database %s from schema %s to %s through the leader", header.Name, current.Version, schema.Version)
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+	"github.com/vexxhost/ovsinit/pkg/config"
+	"github.com/vexxhost/ovsinit/pkg/succession"
+	"github.com/vexxhost/ovsinit/pkg/verifier"
+)
+
+const (
+	PRESTOP_COMMAND = "prestop"
+)
+
+// prestop stops the daemon when the pod is terminated, unless it was handed
+// off to a new pod, whose daemon must not be touched.  It is meant as the
+// preStop hook of the pod which exec'd the daemon.
+func prestop(args []string) int {
+	fs := flag.NewFlagSet(PRESTOP_COMMAND, flag.ContinueOnError)
+	binary := fs.String("binary", "", "Binary of the daemon to stop")
+	profileName := fs.String("profile", "", "Handoff profile of the daemon, defaults to the one named after the binary")
+	runDir := fs.String("run-dir", "", "Run directory of the daemon, defaults to the one of its profile")
+	backend := fs.String("succession-backend", SUCCESSION_BACKEND_SQLITE, "Succession backend to use (sqlite or lease)")
+	timeout := fs.Duration("timeout", VERIFY_TIMEOUT, "How long to wait for the daemon to exit and clean up")
+	dbPath := fs.String("ovs-db", "", "Path to the database file of the daemon, to leave its cluster")
+	clusterLeave := fs.Bool("ovs-db-cluster-leave", false, "Leave the cluster before stopping the daemon, when the member is being removed")
+	leaveTimeout := fs.Duration("leave-cluster-timeout", LEAVE_CLUSTER_TIMEOUT, "How long to wait for the daemon to leave its cluster")
+	configFile := fs.String("config", "", "Path to a YAML configuration file, flags override its values")
+	level, format := logFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *binary == "" {
+		slog.Error("usage: ovsinit prestop --binary <binary> [--profile <profile>] [--succession-backend sqlite|lease] [--timeout <duration>] [--ovs-db <path> --ovs-db-cluster-leave]")
+		return 2
+	}
+
+	if *configFile != "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			slog.Error("failed to load config", "path", *configFile, "error", err)
+			return 2
+		}
+
+		if err := applyConfig(fs, cfg); err != nil {
+			slog.Error("failed to apply config", "path", *configFile, "error", err)
+			return 2
+		}
+	}
+
+	handler, err := newLogHandler(os.Stderr, *level, *format)
+	if err != nil {
+		slog.Error("failed to configure logging", "error", err)
+		return 2
+	}
+
+	logger := slog.New(handler).With("binary", *binary, "command", PRESTOP_COMMAND)
+	slog.SetDefault(logger)
+
+	prof, err := lookupProfile(*profileName, *binary)
+	if err != nil {
+		slog.Error("failed to find profile", "error", err)
+		return 2
+	}
+
+	if *runDir == "" {
+		*runDir = prof.runDir()
+	}
+
+	if *clusterLeave && (*dbPath == "" || !prof.database) {
+		slog.Error("-ovs-db-cluster-leave requires -ovs-db and a profile serving a database", "profile", prof.name)
+		return 2
+	}
+
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		slog.Error("POD_NAME environment variable must be set for succession tracking")
+		return 1
+	}
+
+	marker, err := newSuccessionMarker(*backend, *runDir, prof.name, podName, succession.MAX_HISTORY, logger.Handler())
+	if err != nil {
+		slog.Error("failed to create succession marker", "error", err)
+		return 1
+	}
+	defer func() {
+		if err := marker.Close(); err != nil {
+			slog.Error("failed to close marker", "error", err)
+		}
+	}()
+
+	// Without knowing who owns the daemon, leaving it running is safer
+	// than stopping the one of a new pod
+	_, wasReplaced, err := marker.CheckSuccession(context.TODO())
+	if err != nil {
+		slog.Error("failed to check succession, leaving process running", "error", err)
+		return 1
+	}
+
+	if wasReplaced {
+		slog.Info("we've been replaced, leaving process to the new owner")
+		return 0
+	}
+
+	err = marker.Resume(context.TODO())
+	switch {
+	case errors.Is(err, succession.ErrNotClaimed):
+		currentOwner, _ := marker.CurrentOwner(context.TODO())
+		slog.Info("not the succession owner, leaving process running", "current_owner", currentOwner)
+		return 0
+	case err != nil:
+		slog.Error("failed to get current owner, leaving process running", "error", err)
+		return 1
+	}
+
+	client, err := prof.dial(*runDir)
+	switch {
+	case errors.Is(err, appctl.ErrNoPidFile), errors.Is(err, appctl.ErrStalePidFile):
+		slog.Info("no existing process found", "error", err)
+		return 0
+	case err != nil:
+		slog.Error("failed to connect to process", "error", err)
+		return 1
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Error("failed to close client", "error", err)
+		}
+	}()
+
+	slog.Info("stopping process")
+
+	// Only a member which is removed leaves its cluster, one which is handed
+	// off must stay in it for the new process
+	if *clusterLeave {
+		if code, ok := validatePrestopClaim(marker); !ok {
+			return code
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *leaveTimeout)
+		err := leaveCluster(ctx, client, *dbPath)
+		cancel()
+		if err != nil {
+			slog.Error("failed to leave cluster, leaving process running", "error", err)
+			return 1
+		}
+	}
+
+	// A new pod may have claimed the daemon while we connected to it
+	if code, ok := validatePrestopClaim(marker); !ok {
+		return code
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	h := &handoff{profile: prof, runDir: *runDir, binary: *binary, pod: podName, client: client}
+	if err := h.stop(ctx); err != nil {
+		slog.Error("failed to stop process", "error", err)
+		return 1
+	}
+
+	if err := verifier.Run(ctx, prof.exitVerifiers(*runDir, client.Process)...); err != nil {
+		slog.Error("verification after exit failed", "error", err)
+		return 1
+	}
+
+	slog.Info("stopped process")
+	return 0
+}
+
+// validatePrestopClaim checks that we still own the daemon, returning the
+// exit code of prestop when we do not
+func validatePrestopClaim(marker *succession.Marker) (int, bool) {
+	err := marker.Validate(context.TODO())
+	switch {
+	case err == nil:
+		return 0, true
+	case errors.Is(err, succession.ErrFenced):
+		slog.Info("succession claim superseded, leaving process to the new owner", "error", err)
+		return 0, false
+	default:
+		slog.Error("failed to validate succession claim, leaving process running", "error", err)
+		return 1, false
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/config"
+)
+
+const (
+	PROBE_COMMAND = "probe"
+	PROBE_TIMEOUT = 5 * time.Second
+)
+
+// checkReadiness runs the readiness commands of the profile against the
+// running daemon, failing on the first one which does not succeed.
+func checkReadiness(ctx context.Context, p *profile, runDir string) error {
+	client, err := p.dial(runDir)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Warn("failed to close client", "error", err)
+		}
+	}()
+
+	for _, command := range p.readiness {
+		if _, err := client.Run(ctx, command[0], command[1:]...); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(command, " "), err)
+		}
+	}
+
+	return nil
+}
+
+// probe checks whether the daemon is serving, for use as the readiness or
+// startup probe of the pod which exec'd it.
+func probe(args []string) int {
+	fs := flag.NewFlagSet(PROBE_COMMAND, flag.ContinueOnError)
+	binary := fs.String("binary", "", "Binary of the daemon to probe")
+	profileName := fs.String("profile", "", "Handoff profile of the daemon, defaults to the one named after the binary")
+	runDir := fs.String("run-dir", "", "Run directory of the daemon, defaults to the one of its profile")
+	timeout := fs.Duration("timeout", PROBE_TIMEOUT, "How long to wait for the daemon to reply")
+	configFile := fs.String("config", "", "Path to a YAML configuration file, flags override its values")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if *binary == "" {
+		slog.Error("usage: ovsinit probe --binary <binary> [--profile <profile>] [--timeout <duration>] [--config <path>]")
+		return 1
+	}
+
+	if *configFile != "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			slog.Error("failed to load config", "path", *configFile, "error", err)
+			return 1
+		}
+
+		if err := applyConfig(fs, cfg); err != nil {
+			slog.Error("failed to apply config", "path", *configFile, "error", err)
+			return 1
+		}
+	}
+
+	prof, err := lookupProfile(*profileName, *binary)
+	if err != nil {
+		slog.Error("failed to find profile", "error", err)
+		return 1
+	}
+
+	if *runDir == "" {
+		*runDir = prof.runDir()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if err := checkReadiness(ctx, prof, *runDir); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s is not ready: %v\n", prof.name, err)
+		return 1
+	}
+
+	return 0
+}
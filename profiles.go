@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+	"github.com/vexxhost/ovsinit/pkg/compat"
+	"github.com/vexxhost/ovsinit/pkg/hooks"
+	"github.com/vexxhost/ovsinit/pkg/verifier"
+)
+
+const (
+	PROFILE_OVSDB_SERVER   = "ovsdb-server"
+	PROFILE_OVS_VSWITCHD   = "ovs-vswitchd"
+	PROFILE_OVN_CONTROLLER = "ovn-controller"
+	PROFILE_OVN_NORTHD     = "ovn-northd"
+	PROFILE_OVN_NB_DB      = "ovn-nb-db"
+	PROFILE_OVN_SB_DB      = "ovn-sb-db"
+	PROFILE_OVN_IC         = "ovn-ic"
+)
+
+// handoff is the state of replacing the existing daemon, shared by the
+// steps of its profile
+type handoff struct {
+	profile *profile
+	binary  string
+	pod     string
+	runDir  string
+	client  *appctl.Client
+	start   time.Time
+
+	// flowsDir holds the flows saved before exiting, which are restored
+	// into the new daemon
+	flowsDir string
+
+	// hooks are the site-specific actions run at the phases of the
+	// handoff
+	hooks hooks.Hooks
+
+	// compat decides whether the versions of the existing and new daemons
+	// are safe to hand off between
+	compat compat.Policy
+
+	phases          []phase
+	replacedVersion string
+	incomingVersion string
+}
+
+// step is run against the existing daemon before it is asked to exit
+type step struct {
+	name string
+	run  func(ctx context.Context, h *handoff) error
+
+	// optional steps only log a warning when they fail
+	optional bool
+}
+
+// profile describes how to hand off a daemon
+type profile struct {
+	// name is the name of the pid file and control socket of the daemon,
+	// which also keys its succession, defaulting to the binary
+	name string
+
+	// binary is the binary the daemon must run as, any when empty
+	binary string
+
+	runDir      func() string
+	exitCommand string
+	exitArgs    []string
+	preExit     []step
+
+	// hugePages is whether to wait for the hugepages of the daemon to be
+	// released after it exited
+	hugePages bool
+
+	// fileRemoval are glob patterns of files which must be removed after
+	// the daemon exited, in addition to its pid file and sockets
+	fileRemoval []string
+
+	// fixedSocket is whether the daemon is started with a control socket
+	// named without its pid through --unixctl
+	fixedSocket bool
+
+	// database is whether the daemon serves the database set up by the
+	// -ovs-db flags
+	database bool
+
+	// readiness are the commands which must succeed for the daemon to be
+	// considered ready
+	readiness [][]string
+}
+
+var saveFlowsStep = step{
+	name: "save-flows",
+	run: func(ctx context.Context, h *handoff) error {
+		dir, err := saveFlows(ctx, h.runDir)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("saved flows", "dir", dir)
+		h.flowsDir = dir
+		return nil
+	},
+	optional: true,
+}
+
+var profiles = map[string]profile{
+	PROFILE_OVSDB_SERVER: {
+		binary:    "ovsdb-server",
+		runDir:    appctl.OVSRunDir,
+		database:  true,
+		readiness: [][]string{{"version"}, {"ovsdb-server/list-dbs"}},
+	},
+	PROFILE_OVS_VSWITCHD: {
+		binary:    "ovs-vswitchd",
+		runDir:    appctl.OVSRunDir,
+		preExit:   []step{saveFlowsStep},
+		hugePages: true,
+		readiness: [][]string{{"version"}, {"dpif/show"}},
+	},
+	PROFILE_OVN_CONTROLLER: {
+		binary: "ovn-controller",
+		runDir: appctl.OVNRunDir,
+
+		// Keep the chassis and its flows in place for the new process
+		exitArgs:  []string{"--restart"},
+		readiness: [][]string{{"version"}},
+	},
+	PROFILE_OVN_NORTHD: {
+		binary:    "ovn-northd",
+		runDir:    appctl.OVNRunDir,
+		readiness: [][]string{{"version"}, {"status"}},
+	},
+	PROFILE_OVN_NB_DB: {
+		name:        "ovnnb_db",
+		binary:      "ovsdb-server",
+		runDir:      appctl.OVNRunDir,
+		fixedSocket: true,
+		database:    true,
+		readiness:   [][]string{{"version"}, {"ovsdb-server/list-dbs"}},
+	},
+	PROFILE_OVN_SB_DB: {
+		name:        "ovnsb_db",
+		binary:      "ovsdb-server",
+		runDir:      appctl.OVNRunDir,
+		fixedSocket: true,
+		database:    true,
+		readiness:   [][]string{{"version"}, {"ovsdb-server/list-dbs"}},
+	},
+	PROFILE_OVN_IC: {
+		binary:    "ovn-ic",
+		runDir:    appctl.OVNRunDir,
+		readiness: [][]string{{"version"}},
+	},
+}
+
+// lookupProfile returns the named profile, or the one of binary when no
+// name is given.  Binaries without a profile get a generic one.
+func lookupProfile(name, binary string) (*profile, error) {
+	p, ok := profiles[name]
+	switch {
+	case name == "":
+		p, ok = profiles[binary]
+		if !ok {
+			p = profile{
+				runDir:    func() string { return appctl.RunDir(binary) },
+				database:  true,
+				readiness: [][]string{{"version"}},
+			}
+		}
+	case !ok:
+		return nil, fmt.Errorf("unknown profile %q", name)
+	case p.binary != "" && p.binary != binary:
+		return nil, fmt.Errorf("profile %q runs %s instead of %s", name, p.binary, binary)
+	}
+
+	if p.name == "" {
+		p.name = binary
+	}
+	if p.binary == "" {
+		p.binary = binary
+	}
+	if p.exitCommand == "" {
+		p.exitCommand = "exit"
+	}
+
+	return &p, nil
+}
+
+// dial connects to the running daemon of the profile
+func (p *profile) dial(runDir string) (*appctl.Client, error) {
+	return appctl.DialDaemon(runDir, p.name, p.binary)
+}
+
+// exitVerifiers returns the verifiers checking that process has exited and
+// cleaned up after itself, waiting on its pidfd or checking its start time
+// so that a reused pid is not mistaken for it
+func (p *profile) exitVerifiers(runDir string, process *appctl.Process) []verifier.Verifier {
+	exit := verifier.ProcessExitStarted(process.Pid, process.StartTime)
+	if process.Fd() >= 0 {
+		exit = verifier.ProcessExitFd(process.Pid, process.Fd())
+	}
+
+	verifiers := []verifier.Verifier{
+		exit,
+		verifier.FileRemoval(appctl.PidFile(runDir, p.name)),
+		verifier.FileRemoval(appctl.SocketPattern(runDir, p.name)),
+	}
+
+	if p.fixedSocket {
+		verifiers = append(verifiers, verifier.FileRemoval(appctl.FixedSocket(runDir, p.name)))
+	}
+
+	for _, pattern := range p.fileRemoval {
+		verifiers = append(verifiers, verifier.FileRemoval(pattern))
+	}
+
+	if p.hugePages {
+		verifiers = append(verifiers, verifier.HugePages())
+	}
+
+	return verifiers
+}
+
+// runPreExit runs the steps to take before asking the daemon to exit
+func (h *handoff) runPreExit(ctx context.Context) error {
+	for _, s := range h.profile.preExit {
+		err := s.run(ctx, h)
+		switch {
+		case err == nil:
+		case s.optional:
+			slog.Warn("optional step failed, continuing", "step", s.name, "error", err)
+		default:
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+
+	return nil
+}
+
+// exit asks the daemon to exit with the command of its profile
+func (h *handoff) exit(ctx context.Context) error {
+	_, err := h.client.Run(ctx, h.profile.exitCommand, h.profile.exitArgs...)
+	return err
+}
+
+// stop asks the daemon to exit for good when it is removed rather than
+// handed off, without the arguments such as --restart which keep its state
+// for the next instance
+func (h *handoff) stop(ctx context.Context) error {
+	_, err := h.client.Run(ctx, h.profile.exitCommand)
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"time"
+)
+
+type phaseReport struct {
+	Name       string    `json:"name"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// handoffReport describes one run of ovsinit, so that a slow or failed
+// restart can be understood without correlating its logs.
+type handoffReport struct {
+	Daemon  string `json:"daemon"`
+	Binary  string `json:"binary"`
+	Pod     string `json:"pod"`
+	Outcome string `json:"outcome"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// HandoffDurationMs is the time from asking the existing daemon to exit
+	// until the new one was started
+	HandoffDurationMs int64 `json:"handoff_duration_ms,omitempty"`
+
+	ReplacedVersion string        `json:"replaced_version,omitempty"`
+	IncomingVersion string        `json:"incoming_version,omitempty"`
+	Generation      uint          `json:"generation,omitempty"`
+	Phases          []phaseReport `json:"phases"`
+}
+
+func (h *handoff) report(outcome string, generation uint, restartStart time.Time) handoffReport {
+	report := handoffReport{
+		Daemon:          h.profile.name,
+		Binary:          h.binary,
+		Pod:             h.pod,
+		Outcome:         outcome,
+		Start:           h.start,
+		End:             time.Now(),
+		ReplacedVersion: h.replacedVersion,
+		IncomingVersion: h.incomingVersion,
+		Generation:      generation,
+		Phases:          make([]phaseReport, 0, len(h.phases)),
+	}
+
+	if !restartStart.IsZero() {
+		report.HandoffDurationMs = report.End.Sub(restartStart).Milliseconds()
+	}
+
+	for _, p := range h.phases {
+		phase := phaseReport{
+			Name:       p.name,
+			Start:      p.start,
+			End:        p.end,
+			DurationMs: p.duration().Milliseconds(),
+		}
+		if p.err != nil {
+			phase.Error = p.err.Error()
+		}
+
+		report.Phases = append(report.Phases, phase)
+	}
+
+	return report
+}
+
+// writeReport logs the report of the handoff as a single JSON record, which
+// is also written to the report file if one is configured.
+func (h *handoff) writeReport(outcome string, generation uint, restartStart time.Time) {
+	data, err := json.Marshal(h.report(outcome, generation, restartStart))
+	if err != nil {
+		slog.Warn("failed to encode handoff report", "error", err)
+		return
+	}
+
+	// Logged as raw JSON so the report stays one record whatever the log
+	// format, while following the configured level
+	slog.Info("handoff report", "report", json.RawMessage(data))
+
+	if *reportFile == "" {
+		return
+	}
+
+	if err := os.WriteFile(*reportFile, append(data, '\n'), 0o644); err != nil {
+		slog.Warn("failed to write handoff report", "path", *reportFile, "error", err)
+	}
+}
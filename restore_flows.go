@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/vexxhost/ovsinit/pkg/appctl"
+	"github.com/vexxhost/ovsinit/pkg/flows"
+	"github.com/vexxhost/ovsinit/pkg/ovsdb"
+)
+
+const (
+	RESTORE_FLOWS_COMMAND = "restore-flows"
+	RESTORE_FLOWS_TIMEOUT = 60 * time.Second
+)
+
+// saveFlows dumps the flows of every bridge into a new directory in runDir,
+// which is left to startFlowRestore or removed by discardFlows.
+func saveFlows(ctx context.Context, runDir string) (string, error) {
+	dir, err := os.MkdirTemp(runDir, ".flows-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create flows directory: %w", err)
+	}
+
+	client, err := dialDatabase(runDir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Warn("failed to close database client", "error", err)
+		}
+	}()
+
+	if _, err := flows.Save(ctx, client, runDir, dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// discardFlows removes the saved flows when the handoff does not get as far
+// as restoring them.
+func (h *handoff) discardFlows() {
+	if h.flowsDir == "" {
+		return
+	}
+
+	if err := os.RemoveAll(h.flowsDir); err != nil {
+		slog.Warn("failed to remove flows directory", "dir", h.flowsDir, "error", err)
+	}
+	h.flowsDir = ""
+}
+
+// dialDatabase connects to the database socket in runDir, which
+// ovs-vswitchd shares with its ovsdb-server
+func dialDatabase(runDir string) (*ovsdb.Client, error) {
+	client, err := ovsdb.Dial("unix:" + filepath.Join(runDir, "db.sock"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return client, nil
+}
+
+// setRestoreWait toggles flow-restore-wait through the database of runDir
+func setRestoreWait(ctx context.Context, runDir string, enabled bool) error {
+	client, err := dialDatabase(runDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Warn("failed to close database client", "error", err)
+		}
+	}()
+
+	return flows.SetRestoreWait(ctx, client, enabled)
+}
+
+// startFlowRestore sets flow-restore-wait, so the new ovs-vswitchd keeps the
+// datapath intact, and spawns a detached copy of ovsinit which outlives the
+// exec, replays the saved flows once it is up and clears flow-restore-wait.
+// Like ovs-ctl, this only happens right before starting the new daemon, so
+// flow-restore-wait is never left behind by a handoff which fails earlier.
+func startFlowRestore(ctx context.Context, runDir, dir string) error {
+	if err := setRestoreWait(ctx, runDir, true); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("/proc/self/exe", RESTORE_FLOWS_COMMAND,
+		"-run-dir", runDir,
+		"-log-level", *logLevel,
+		"-log-format", *logFormat,
+		dir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start flow restore: %w", err)
+	}
+
+	return cmd.Process.Release()
+}
+
+func restoreFlows(args []string) int {
+	fs := flag.NewFlagSet(RESTORE_FLOWS_COMMAND, flag.ContinueOnError)
+	runDir := fs.String("run-dir", appctl.RunDir("ovs-vswitchd"), "Run directory of ovs-vswitchd")
+	level, format := logFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		slog.Error("usage: ovsinit restore-flows [-run-dir <dir>] [-log-level <level>] [-log-format text|json] <dir>")
+		return 1
+	}
+	dir := fs.Arg(0)
+
+	handler, err := newLogHandler(os.Stderr, *level, *format)
+	if err != nil {
+		slog.Error("failed to configure logging", "error", err)
+		return 1
+	}
+
+	logger := slog.New(handler).With("binary", "ovs-vswitchd", "command", RESTORE_FLOWS_COMMAND)
+	slog.SetDefault(logger)
+
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("failed to remove flows directory", "error", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RESTORE_FLOWS_TIMEOUT)
+	defer cancel()
+
+	bridges, err := flows.Load(dir)
+	if err != nil {
+		slog.Error("failed to load saved flows", "error", err)
+		return 1
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	pending := bridges
+	for len(pending) > 0 && ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			continue
+		}
+
+		client, err := appctl.DialBinary(*runDir, "ovs-vswitchd")
+		if err != nil {
+			continue
+		}
+		_ = client.Close()
+
+		var failed []flows.Bridge
+		for _, bridge := range pending {
+			if err := flows.Restore(ctx, *runDir, dir, bridge); err != nil {
+				slog.Debug("failed to restore bridge, retrying", "bridge", bridge.Name, "error", err)
+				failed = append(failed, bridge)
+			}
+		}
+		pending = failed
+	}
+
+	// Always clear flow-restore-wait, otherwise ovs-vswitchd never connects
+	// to its controllers and they cannot recover the flows we failed to.
+	clearCtx, clearCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearCancel()
+
+	if err := setRestoreWait(clearCtx, *runDir, false); err != nil {
+		slog.Error("failed to clear flow-restore-wait", "error", err)
+		return 1
+	}
+
+	if len(pending) > 0 {
+		slog.Error("timeout waiting to restore flows", "pending", len(pending))
+		return 1
+	}
+
+	slog.Info("restored flows", "bridges", len(bridges))
+	return 0
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/vexxhost/ovsinit/pkg/succession"
+)
+
+// supervise starts the daemon as a child instead of exec'ing it, so that
+// ovsinit stays PID 1 to forward signals, reap orphans and record how the
+// daemon exited.  It returns the exit code of ovsinit once the daemon
+// exited, or an error if it could not be started.
+func (h *handoff) supervise(marker *succession.Marker, path string, args []string) (int, error) {
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGCHLD)
+	defer signal.Stop(signals)
+
+	process, err := os.StartProcess(path, append([]string{path}, args...), &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("supervising process", "pid", process.Pid)
+
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGCHLD:
+			if status, exited := reap(process.Pid); exited {
+				return h.supervisedExit(marker, status), nil
+			}
+		case syscall.SIGTERM:
+			// Keep reaping while the daemon exits
+			go h.stopSupervised(marker, process)
+		default:
+			slog.Info("forwarding signal", "signal", sig)
+			if err := process.Signal(sig); err != nil {
+				slog.Warn("failed to forward signal", "signal", sig, "error", err)
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+// reap waits for every child which exited, including orphans reparented to
+// us, and returns the status of pid if it was one of them.
+func reap(pid int) (syscall.WaitStatus, bool) {
+	var status syscall.WaitStatus
+	var exited bool
+
+	for {
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil || wpid <= 0 {
+			return status, exited
+		}
+
+		if wpid == pid {
+			status, exited = ws, true
+		} else {
+			slog.Debug("reaped orphan", "pid", wpid)
+		}
+	}
+}
+
+// exitCode returns the exit code of ovsinit matching status, following the
+// shell convention for signals
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return status.ExitStatus()
+}
+
+// exitStatus describes status the way os.ProcessState does
+func exitStatus(status syscall.WaitStatus) string {
+	if status.Signaled() {
+		return fmt.Sprintf("signal: %s", status.Signal())
+	}
+
+	return fmt.Sprintf("exit status %d", status.ExitStatus())
+}
+
+// supervisedExit records how the supervised daemon exited on our claim
+func (h *handoff) supervisedExit(marker *succession.Marker, status syscall.WaitStatus) int {
+	slog.Info("process exited", "status", exitStatus(status))
+
+	err := marker.RecordExit(context.TODO(), exitStatus(status))
+	switch {
+	case err == nil:
+	case errors.Is(err, succession.ErrFenced):
+		slog.Info("succession claim superseded, not recording exit", "error", err)
+	default:
+		slog.Warn("failed to record exit", "error", err)
+	}
+
+	return exitCode(status)
+}
+
+// stopSupervised asks the supervised daemon to exit through appctl as long
+// as we still own it, since a new owner is handing it off already.  Signals
+// are only a fallback when the daemon cannot be asked to exit.
+func (h *handoff) stopSupervised(marker *succession.Marker, process *os.Process) {
+	if err := marker.Validate(context.TODO()); errors.Is(err, succession.ErrFenced) {
+		slog.Info("succession claim superseded, leaving process to the new owner", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *verifyTimeout)
+	defer cancel()
+
+	err := h.stopDaemon(ctx)
+	if err == nil {
+		slog.Info("asked process to exit")
+		return
+	}
+
+	slog.Warn("failed to ask process to exit, forwarding signal", "error", err)
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		slog.Warn("failed to forward signal", "signal", syscall.SIGTERM, "error", err)
+	}
+}
+
+// stopDaemon connects to the running daemon and asks it to exit for good
+func (h *handoff) stopDaemon(ctx context.Context) error {
+	client, err := h.profile.dial(h.runDir)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			slog.Warn("failed to close client", "error", err)
+		}
+	}()
+
+	// Not a handoff, so without the exit arguments of the profile
+	_, err = client.Run(ctx, h.profile.exitCommand)
+	return err
+}